@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/darfkts3service"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/pgts3store"
+)
+
+var configCheckConnect bool
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "works with the config file",
+	Long:  `usage: eve-ts3-service config check [--connect]`,
+}
+
+var configCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "validates the config file",
+	Long: `usage: eve-ts3-service config check [--connect]
+It will report every problem found in the config file.
+With --connect it also connects to postgres, ts3 server and
+the validation endpoint.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initConfig()
+		c := system.NewViperConfig()
+
+		if err := c.Validate(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Config is valid")
+		if !configCheckConnect {
+			return
+		}
+
+		// Failed checks are reported below, keep stack traces out of output.
+		log.SetOutput(ioutil.Discard)
+		sys := system.NewWithConfig(c)
+		ok := true
+		ok = checkConnection("postgres", func() {
+			db, err := sqlx.Connect("postgres", c.PgConnString)
+			system.HandleError(err)
+			db.Close()
+		}) && ok
+		ok = checkConnection("ts3 server", func() {
+			ts3Service := darfkts3service.New(sys, pgts3store.New(nil), nil)
+			ts3Service.Connect()
+			ts3Service.Stop()
+		}) && ok
+		if c.UsersValidator == "" || c.UsersValidator == "http" {
+			ok = checkConnection("validation endpoint", func() {
+				client := &http.Client{Timeout: 30 * time.Second}
+				resp, err := client.Post(c.UsersValidationEndpoint,
+					"application/json", bytes.NewBufferString("[]"))
+				system.HandleError(err)
+				resp.Body.Close()
+				if resp.StatusCode != 200 {
+					system.HandleError(fmt.Errorf("unexpected response %s",
+						resp.Status))
+				}
+			}) && ok
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	configCheckCmd.Flags().BoolVar(&configCheckConnect, "connect", false, "also test connectivity to postgres, ts3 server and validation endpoint")
+
+	configCmd.AddCommand(configCheckCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// checkConnection runs f and reports whether it succeeded.
+func checkConnection(name string, f func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("%s: FAILED: %s\n", name, r)
+			ok = false
+		}
+	}()
+	f()
+	fmt.Printf("%s: ok\n", name)
+
+	return true
+}
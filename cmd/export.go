@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/dump"
+)
+
+var (
+	exportFormat string
+	exportKind   string
+	exportFile   string
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "exports users, groups, grants, guest requests and audit events",
+	Long: `usage: eve-ts3-service export [--format json|csv] [--kind users|groups|grants|guests|audit] [--file FILE]
+A json dump holds all records. A csv dump holds records of one --kind.
+The dump is written to stdout unless --file is set.
+It works directly with the configured database, the service doesn't have
+to be running.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if exportFormat != "json" && exportFormat != "csv" {
+			fmt.Printf("Unknown format %q, use --format csv or json\n", exportFormat)
+			os.Exit(1)
+		}
+
+		_, store, db := openStore()
+		defer db.Close()
+
+		var w io.Writer = os.Stdout
+		if exportFile != "" {
+			f, err := os.Create(exportFile)
+			system.HandleError(err)
+			defer f.Close()
+			w = f
+		}
+
+		d := dump.Export(store)
+		var err error
+		if exportFormat == "csv" {
+			err = d.WriteCSV(w, exportKind)
+		} else {
+			err = d.WriteJSON(w)
+		}
+		system.HandleError(err, "export")
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormat, "format", "json", "dump format, json or csv")
+	exportCmd.Flags().StringVar(&exportKind, "kind", dump.KindUsers, "records to export as csv, users, groups, grants, guests or audit")
+	exportCmd.Flags().StringVarP(&exportFile, "file", "f", "", "file to write the dump to")
+
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+var (
+	grantSGID     string
+	grantUID      string
+	grantCharID   int32
+	grantReason   string
+	grantStart    string
+	grantDuration time.Duration
+)
+
+// grantsCmd represents the grants command
+var grantsCmd = &cobra.Command{
+	Use:   "grants",
+	Short: "manages time limited group memberships in a running service",
+	Long: `usage: eve-ts3-service grants list|add|revoke
+A grant adds a ts3 client or all users of an eve character to a server group
+and removes them from the group when it expires.`,
+}
+
+var grantsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists grants",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var grants []ts3.Grant
+		serviceRequest("GET", "/api/ts3/v1/grants", nil, 200, &grants)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSGID\tTARGET\tSTARTS\tEXPIRES\tSTATE\tREASON")
+		for _, g := range grants {
+			target := g.TS3UID
+			if target == "" {
+				target = "char " + strconv.Itoa(int(g.EveCharID))
+			}
+			state := "pending"
+			switch {
+			case g.Done:
+				state = "done"
+			case g.Applied:
+				state = "applied"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", g.ID, g.SGID,
+				target, formatTime(g.StartsAt), formatTime(g.ExpiresAt), state,
+				g.Reason)
+		}
+		w.Flush()
+	},
+}
+
+var grantsAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "grants a server group until it expires",
+	Long: `usage: eve-ts3-service grants add --sgid 10 --uid UID --duration 48h
+Either --uid or --char is required. --start delays the grant,
+e.g. --start 2019-06-01T18:00:00Z`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		req := map[string]interface{}{
+			"SGID":      grantSGID,
+			"TS3UID":    grantUID,
+			"EveCharID": grantCharID,
+			"Reason":    grantReason,
+			"Duration":  int64(grantDuration / time.Second),
+		}
+		if grantStart != "" {
+			start, err := time.Parse(time.RFC3339, grantStart)
+			system.HandleError(err, "cmd.grants.add")
+			req["StartsAt"] = start.Unix()
+		}
+
+		var g ts3.Grant
+		serviceRequest("POST", "/api/ts3/v1/grants", req, 201, &g)
+		fmt.Printf("Grant %d created, expires at %s\n", g.ID,
+			formatTime(g.ExpiresAt))
+	},
+}
+
+var grantsRevokeCmd = &cobra.Command{
+	Use:   "revoke ID",
+	Short: "expires a grant right away",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, err := strconv.Atoi(args[0])
+		system.HandleError(err, "cmd.grants.revoke")
+
+		serviceRequest("DELETE", "/api/ts3/v1/grants/"+args[0], nil, 200, nil)
+		fmt.Println("Grant revoked")
+	},
+}
+
+func init() {
+	grantsAddCmd.Flags().StringVar(&grantSGID, "sgid", "", "server group id")
+	grantsAddCmd.Flags().StringVar(&grantUID, "uid", "", "ts3 unique id")
+	grantsAddCmd.Flags().Int32Var(&grantCharID, "char", 0, "eve character id")
+	grantsAddCmd.Flags().StringVar(&grantReason, "reason", "", "why the group is granted")
+	grantsAddCmd.Flags().StringVar(&grantStart, "start", "", "when the grant starts, RFC3339 (default now)")
+	grantsAddCmd.Flags().DurationVar(&grantDuration, "duration", 0, "how long the grant lasts, e.g. 48h")
+	grantsAddCmd.MarkFlagRequired("sgid")
+	grantsAddCmd.MarkFlagRequired("duration")
+
+	grantsCmd.AddCommand(grantsListCmd, grantsAddCmd, grantsRevokeCmd)
+	rootCmd.AddCommand(grantsCmd)
+}
+
+// serviceRequest sends a request to the api of a running service and
+// decodes json response into v. It exits if the response code is not
+// the expected one.
+func serviceRequest(method, path string, body interface{}, expected int,
+	v interface{}) {
+	initConfig()
+	c := system.NewViperConfig()
+
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, err := http.NewRequest(method, "http://"+c.WebServerAddress+path,
+		bytes.NewReader(payload))
+	system.HandleError(err, "cmd.serviceRequest")
+	req.Header.Set("Content-Type", "application/json")
+	if c.AdminSecret != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AdminSecret)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	system.HandleError(err, "cmd.serviceRequest")
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expected {
+		var e map[string]string
+		json.NewDecoder(resp.Body).Decode(&e)
+		fmt.Println("Unexpected response:", resp.StatusCode, e["error"])
+		os.Exit(1)
+	}
+	if v != nil {
+		err = json.NewDecoder(resp.Body).Decode(v)
+		system.HandleError(err, "cmd.serviceRequest")
+	}
+}
+
+// formatTime formats a unix timestamp for output.
+func formatTime(t int64) string {
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
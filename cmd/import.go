@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+var (
+	importFormat string
+	importGroups []string
+	importDryRun bool
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import FILE",
+	Short: "imports existing ts3 members into the database",
+	Long: `usage: eve-ts3-service import FILE [--groups SGID,...] [--dry-run]
+FILE is a csv with a header or a json array of users with fields
+TS3UID, EveCharID, EveCharName, EveCorpID, EveCorpName, EveCorpTicker,
+EveAlliID, EveAlliName, EveAlliTicker.
+Users with TS3UID get cldbid resolved on ts3 server. Users without it
+are matched by EveCharName against nicknames of members of --groups.
+Imported users are validated on the next validation run.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		users := readImportFile(args[0])
+
+		sys, store, db := openStore()
+		defer db.Close()
+		ts3Service := connectTS3(sys, store)
+		defer ts3Service.Stop()
+
+		results := ts3Service.ImportUsers(users, importGroups, importDryRun)
+		counts := make(map[string]int)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STATUS\tCHAR ID\tCHARACTER\tTS3 UID\tCLDBID")
+		for _, r := range results {
+			counts[r.Status]++
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", r.Status, r.User.EveCharID,
+				r.User.EveCharName, r.User.TS3UID, r.User.TS3CLDBID)
+		}
+		w.Flush()
+
+		if importDryRun {
+			fmt.Print("Dry run, nothing was stored. ")
+		}
+		fmt.Printf("%d created, %d exist, %d duplicate, %d not found\n",
+			counts[ts3.ImportCreated], counts[ts3.ImportExists],
+			counts[ts3.ImportDuplicate], counts[ts3.ImportNotFound])
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importFormat, "format", "", "file format, csv or json (default from file extension)")
+	importCmd.Flags().StringSliceVar(&importGroups, "groups", nil, "server groups to match nicknames of members against EveCharName")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "report what would be imported without storing anything")
+
+	rootCmd.AddCommand(importCmd)
+}
+
+// readImportFile reads users from a csv or json file.
+func readImportFile(path string) []*ts3.User {
+	f, err := os.Open(path)
+	system.HandleError(err)
+	defer f.Close()
+
+	format := importFormat
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	switch format {
+	case "json":
+		var users []*ts3.User
+		err = json.NewDecoder(f).Decode(&users)
+		system.HandleError(err, "import", "file="+path)
+		return users
+	case "csv":
+		return readImportCSV(f)
+	}
+
+	fmt.Printf("Unknown format %q, use --format csv or json\n", format)
+	os.Exit(1)
+	return nil
+}
+
+// readImportCSV reads users from csv with a header naming user fields.
+// Unknown columns are ignored.
+func readImportCSV(r io.Reader) []*ts3.User {
+	records, err := csv.NewReader(r).ReadAll()
+	system.HandleError(err, "import")
+	if len(records) == 0 {
+		return nil
+	}
+
+	header := records[0]
+	users := make([]*ts3.User, 0, len(records)-1)
+	for _, record := range records[1:] {
+		u := &ts3.User{}
+		for i, field := range header {
+			v := strings.TrimSpace(record[i])
+			switch strings.TrimSpace(field) {
+			case "TS3UID":
+				u.TS3UID = v
+			case "EveCharID":
+				u.EveCharID = parseID(v)
+			case "EveCharName":
+				u.EveCharName = v
+			case "EveCorpID":
+				u.EveCorpID = parseID(v)
+			case "EveCorpName":
+				u.EveCorpName = v
+			case "EveCorpTicker":
+				u.EveCorpTicker = v
+			case "EveAlliID":
+				u.EveAlliID = parseID(v)
+			case "EveAlliName":
+				u.EveAlliName = v
+			case "EveAlliTicker":
+				u.EveAlliTicker = v
+			}
+		}
+		users = append(users, u)
+	}
+
+	return users
+}
+
+// parseID parses an eve id, empty string means 0.
+func parseID(v string) int32 {
+	if v == "" {
+		return 0
+	}
+	id, err := strconv.ParseInt(v, 10, 32)
+	system.HandleError(err, "import", "id="+v)
+
+	return int32(id)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/dump"
+)
+
+var (
+	restoreFormat string
+	restoreKind   string
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore FILE",
+	Short: "restores a dump made by export",
+	Long: `usage: eve-ts3-service restore FILE [--format json|csv] [--kind users|groups|grants|guests|audit]
+The dump is validated and its records are created in the configured
+database in a single transaction. Records of a kind are only restored if
+the database has none of them yet. A csv dump needs --kind of its records.
+Guest requests which refer to grants are restored only from json dumps.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.Open(args[0])
+		system.HandleError(err)
+		defer f.Close()
+
+		format := restoreFormat
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(args[0])), ".")
+		}
+
+		var d *dump.Dump
+		switch format {
+		case "json":
+			d, err = dump.ReadJSON(f)
+		case "csv":
+			d, err = dump.ReadCSV(f, restoreKind)
+		default:
+			fmt.Printf("Unknown format %q, use --format csv or json\n", format)
+			os.Exit(1)
+		}
+		if err == nil {
+			err = d.Validate()
+		}
+		if err != nil {
+			fmt.Println("Invalid dump:", err)
+			os.Exit(1)
+		}
+
+		_, store, db := openStore()
+		defer db.Close()
+		err = dump.Restore(store, d)
+		if err != nil {
+			fmt.Println("Restore failed:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Restored %d users, %d groups, %d grants, "+
+			"%d guest requests, %d audit events\n", len(d.Users),
+			len(d.Groups), len(d.Grants), len(d.GuestRequests),
+			len(d.AuditEvents))
+	},
+}
+
+func init() {
+	restoreCmd.Flags().StringVar(&restoreFormat, "format", "", "dump format, csv or json (default from file extension)")
+	restoreCmd.Flags().StringVar(&restoreKind, "kind", dump.KindUsers, "records of a csv dump, users, groups, grants, guests or audit")
+
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -10,7 +10,10 @@ import (
 	"github.com/prusya/eve-ts3-service/pkg/system"
 )
 
-var cfgFile string
+var (
+	cfgFile   string
+	container bool
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -40,6 +43,9 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./config.json)")
+	rootCmd.PersistentFlags().BoolVar(&container, "container",
+		os.Getenv("EVETS3_CONTAINER") == "true",
+		"read config from defaults and EVETS3_* variables without a config file, log to stdout (default is $EVETS3_CONTAINER)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -47,7 +53,16 @@ func init() {
 }
 
 // initConfig reads in config file and ENV variables if set.
+// Defaults are used for fields set by neither of them. In container mode
+// the config file is optional.
 func initConfig() {
+	system.SetDefaults()
+	if container && cfgFile == "" {
+		err := system.ApplyEnv(os.LookupEnv)
+		system.HandleError(err, "cmd.initConfig")
+		return
+	}
+
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
@@ -62,4 +77,8 @@ func initConfig() {
 	err := viper.ReadInConfig()
 	system.HandleError(err, "cmd.initConfig")
 	fmt.Println("Using config file:", viper.ConfigFileUsed())
+
+	// EVETS3_* variables override values from the file.
+	err = system.ApplyEnv(os.LookupEnv)
+	system.HandleError(err, "cmd.initConfig")
 }
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -10,10 +12,18 @@ import (
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
+	"github.com/prusya/eve-ts3-service/pkg/esi"
 	"github.com/prusya/eve-ts3-service/pkg/http/gorillahttp"
+	"github.com/prusya/eve-ts3-service/pkg/leader/pgleader"
+	"github.com/prusya/eve-ts3-service/pkg/notify/webhooknotify"
 	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/allowlistts3validator"
 	"github.com/prusya/eve-ts3-service/pkg/ts3/darfkts3service"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/esits3validator"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/httpts3validator"
 	"github.com/prusya/eve-ts3-service/pkg/ts3/pgts3store"
 )
 
@@ -23,50 +33,173 @@ var runpgCmd = &cobra.Command{
 	Short: "starts the service",
 	Long: `usage: eve-ts3-service run
 It will start the main functionality of the service.
-Make sure to run "eve-ts3-service init" and fill the config file before "run".`,
+Make sure to run "eve-ts3-service init" and fill the config file before "run".
+With --container no init is needed, config is read from EVETS3_* variables
+and logs are written to stdout.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Moved from root cmd cos we need to read config on demand, not always.
 		initConfig()
 
-		// Setup logger.
-		date := time.Now().Format("2006-01-02_15-04-05")
-		f, err := os.OpenFile("logs/log_"+date+".txt", os.O_WRONLY|os.O_CREATE, 0644)
-		system.HandleError(err)
-		defer f.Close()
-		log.SetOutput(f)
+		// Setup logger. Containers log to stdout.
+		if container {
+			log.SetOutput(os.Stdout)
+		} else {
+			date := time.Now().Format("2006-01-02_15-04-05")
+			f, err := os.OpenFile("logs/log_"+date+".txt", os.O_WRONLY|os.O_CREATE, 0644)
+			system.HandleError(err)
+			defer f.Close()
+			log.SetOutput(f)
+		}
 		log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-		// Prepare gracefull shutdown.
+		// Shutdown is triggered by SIGINT or SIGTERM, or by a service
+		// sending to SigChan.
 		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, os.Kill, syscall.SIGKILL)
+		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 		// Create shared System for services.
 		sys := system.New(sigChan)
+		if err := sys.Config().Validate(); err != nil {
+			log.Println(err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
 
-		// Connect to db.
-		db, err := sqlx.Connect("postgres", sys.Config.PgConnString)
-		system.HandleError(err)
+		// Connect to db. Containers may start before the db is ready.
+		attempts := 1
+		if container {
+			attempts = dbConnectAttempts
+		}
+		db := connectDB(sys.Config().PgConnString, attempts)
 		defer db.Close()
 
-		// Create http service.
-		httpService := gorillahttp.New(sys)
-		defer httpService.Stop()
+		// Create services. They are started in order and stopped
+		// in reverse order.
+		lc := system.NewLifecycle()
+
+		notifyService := webhooknotify.New(sys)
+		lc.Append(system.Hook{
+			Name: "notify",
+			Start: func(context.Context) error {
+				notifyService.Start()
+				return nil
+			},
+			Stop: notifyService.Shutdown,
+		})
 
-		// Create ts3 service.
+		// Init creates and migrates tables, so no separate step is needed.
 		ts3Store := pgts3store.New(db)
 		ts3Store.Init()
-		ts3Service := darfkts3service.New(sys, ts3Store)
-		defer ts3Service.Stop()
+		ts3Service := darfkts3service.New(sys, ts3Store, newValidator(sys))
+		// Replicas sharing the db elect a leader which holds ts3
+		// connection and runs jobs.
+		if sys.Config().LeaderElection {
+			ts3Service.UseElector(pgleader.New(db))
+		}
+		lc.Append(system.Hook{
+			Name: "ts3",
+			Start: func(context.Context) error {
+				ts3Service.Start()
+				return nil
+			},
+			Stop: ts3Service.Shutdown,
+		})
+
+		httpService := gorillahttp.New(sys)
+		lc.Append(system.Hook{
+			Name: "http",
+			Start: func(context.Context) error {
+				httpService.Start()
+				return nil
+			},
+			Stop: httpService.Shutdown,
+		})
 
-		ts3Service.Start()
-		httpService.Start()
+		// Start stops the hooks already started if one fails.
+		err := lc.Start(context.Background())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 
-		// Handle graceful shutdown.
-		// Actual shutdown is performed in deferred Stop calls.
-		<-sigChan
+		// Reload config on SIGHUP or when the config file changes.
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		go func() {
+			for range hupChan {
+				r, err := sys.ReloadConfigFile()
+				system.LogConfigReload("SIGHUP", r, err)
+			}
+		}()
+		if viper.ConfigFileUsed() != "" {
+			sys.WatchConfig()
+		}
+
+		sig := <-sigChan
+		log.Printf("received %s, shutting down\n", sig)
+		fmt.Println("Shutting down, send the signal again to stop right away")
+		// A second signal skips waiting for running jobs.
+		go func() {
+			<-sigChan
+			log.Println("received second signal, exiting")
+			os.Exit(1)
+		}()
+
+		// ShutdownTimeout set to 0 falls back to the default.
+		timeout := time.Duration(sys.Config().ShutdownTimeout) * time.Second
+		if timeout == 0 {
+			timeout = defaultShutdownTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		err = lc.Stop(ctx)
+		if err != nil {
+			fmt.Println(err)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(runpgCmd)
 }
+
+// dbConnectAttempts is how many times run connects to the db in container
+// mode, waiting dbConnectDelay between attempts.
+const (
+	dbConnectAttempts = 30
+	dbConnectDelay    = 2 * time.Second
+)
+
+// defaultShutdownTimeout is used when ShutdownTimeout is 0.
+const defaultShutdownTimeout = 30 * time.Second
+
+// connectDB connects to postgres making up to attempts tries.
+func connectDB(connString string, attempts int) *sqlx.DB {
+	for i := 1; ; i++ {
+		db, err := sqlx.Connect("postgres", connString)
+		if err == nil || i >= attempts {
+			system.HandleError(err, "cmd.connectDB")
+			return db
+		}
+		log.Printf("cmd: db is not ready, attempt %d of %d: %s\n", i,
+			attempts, err)
+		time.Sleep(dbConnectDelay)
+	}
+}
+
+// newValidator creates users validator configured by UsersValidator.
+func newValidator(sys *system.System) ts3.Validator {
+	switch sys.Config().UsersValidator {
+	case "", "http":
+		return httpts3validator.New(sys)
+	case "allowlist":
+		return allowlistts3validator.New(sys)
+	case "esi":
+		return esits3validator.New(sys, esi.New(sys.Config().ESIBaseURL))
+	}
+
+	err := fmt.Errorf("unknown users validator %q", sys.Config().UsersValidator)
+	system.HandleError(err)
+
+	return nil
+}
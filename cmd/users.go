@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/darfkts3service"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/pgts3store"
+)
+
+var (
+	usersOutput     string
+	usersActiveOnly bool
+	usersWithTS3    bool
+	usersResyncAll  bool
+)
+
+// usersCmd represents the users command
+var usersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "manages user records",
+	Long: `usage: eve-ts3-service users list|show|deactivate|reactivate|delete|resync
+It works directly with the configured database, the service doesn't have
+to be running. Commands with --ts3 flag also connect to ts3 server.
+A user is referred to by ts3 unique id.`,
+}
+
+var usersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists users",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		_, store, db := openStore()
+		defer db.Close()
+
+		var users []*ts3.User
+		for _, u := range store.Users() {
+			if !usersActiveOnly || u.Active {
+				users = append(users, u)
+			}
+		}
+		printUsers(users)
+	},
+}
+
+var usersShowCmd = &cobra.Command{
+	Use:   "show UID|CHARID",
+	Short: "shows users with provided ts3 unique id or eve character id",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, store, db := openStore()
+		defer db.Close()
+
+		var users []*ts3.User
+		if charID, err := strconv.ParseInt(args[0], 10, 32); err == nil {
+			users = store.UsersByCharID(int32(charID))
+		}
+		if u := userByUID(store, args[0]); u != nil {
+			users = append(users, u)
+		}
+		if len(users) == 0 {
+			fmt.Println("No such user")
+			os.Exit(1)
+		}
+		printUsers(users)
+	},
+}
+
+var usersDeactivateCmd = &cobra.Command{
+	Use:   "deactivate UID",
+	Short: "marks a user as inactive",
+	Long: `usage: eve-ts3-service users deactivate UID [--ts3]
+With --ts3 the user is also removed from managed server groups
+and channel groups.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sys, store, db := openStore()
+		defer db.Close()
+		u := mustUserByUID(store, args[0])
+
+		if usersWithTS3 {
+			ts3Service := connectTS3(sys, store)
+			defer ts3Service.Stop()
+			report := ts3Service.RevokeUser(u)
+			for _, g := range report.Removed {
+				fmt.Printf("Removed from group %q sgid=%s\n", g.Name, g.SGID)
+			}
+		}
+		store.SetUserInactiveByUID(u.TS3UID)
+		fmt.Println("User deactivated")
+	},
+}
+
+var usersReactivateCmd = &cobra.Command{
+	Use:   "reactivate UID",
+	Short: "marks a user as active",
+	Long: `usage: eve-ts3-service users reactivate UID [--ts3]
+With --ts3 the user is also added back to proper server group
+and channel groups. The user is validated on the next validation run.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sys, store, db := openStore()
+		defer db.Close()
+		u := mustUserByUID(store, args[0])
+
+		u.Active = true
+		store.UpdateUser(u)
+		if usersWithTS3 && !u.Guest {
+			ts3Service := connectTS3(sys, store)
+			defer ts3Service.Stop()
+			ts3Service.ResyncUser(u)
+		}
+		fmt.Println("User reactivated")
+	},
+}
+
+var usersDeleteCmd = &cobra.Command{
+	Use:   "delete UID",
+	Short: "deletes a user record",
+	Long: `usage: eve-ts3-service users delete UID [--ts3]
+With --ts3 the user is also removed from managed server groups
+and channel groups.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sys, store, db := openStore()
+		defer db.Close()
+		u := mustUserByUID(store, args[0])
+
+		if usersWithTS3 {
+			ts3Service := connectTS3(sys, store)
+			defer ts3Service.Stop()
+			ts3Service.RevokeUser(u)
+		}
+		store.DeleteUserByUID(u.TS3UID)
+		fmt.Println("User deleted")
+	},
+}
+
+var usersResyncCmd = &cobra.Command{
+	Use:   "resync UID|--all",
+	Short: "adds active users back to proper server and channel groups",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if usersResyncAll {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		sys, store, db := openStore()
+		defer db.Close()
+
+		var users []*ts3.User
+		if usersResyncAll {
+			users = store.Users()
+		} else {
+			users = []*ts3.User{mustUserByUID(store, args[0])}
+		}
+
+		ts3Service := connectTS3(sys, store)
+		defer ts3Service.Stop()
+		resynced := 0
+		for _, u := range users {
+			if !u.Active || u.Guest {
+				continue
+			}
+			ts3Service.ResyncUser(u)
+			resynced++
+		}
+		fmt.Printf("Resynced %d users\n", resynced)
+	},
+}
+
+func init() {
+	usersCmd.PersistentFlags().StringVarP(&usersOutput, "output", "o", "table", "output format, table or json")
+	usersListCmd.Flags().BoolVar(&usersActiveOnly, "active", false, "list only active users")
+	for _, c := range []*cobra.Command{usersDeactivateCmd, usersReactivateCmd, usersDeleteCmd} {
+		c.Flags().BoolVar(&usersWithTS3, "ts3", false, "also update groups on ts3 server")
+	}
+	usersResyncCmd.Flags().BoolVar(&usersResyncAll, "all", false, "resync all active users")
+
+	usersCmd.AddCommand(usersListCmd, usersShowCmd, usersDeactivateCmd,
+		usersReactivateCmd, usersDeleteCmd, usersResyncCmd)
+	rootCmd.AddCommand(usersCmd)
+}
+
+// openStore reads the config and connects to the configured store.
+func openStore() (*system.System, *pgts3store.Store, *sqlx.DB) {
+	initConfig()
+	sys := system.NewWithConfig(system.NewViperConfig())
+
+	db, err := sqlx.Connect("postgres", sys.Config().PgConnString)
+	system.HandleError(err)
+	store := pgts3store.New(db)
+	store.Init()
+
+	return sys, store, db
+}
+
+// connectTS3 connects to ts3 server without starting the service's jobs.
+func connectTS3(sys *system.System, store ts3.Store) *darfkts3service.Service {
+	ts3Service := darfkts3service.New(sys, store, nil)
+	ts3Service.Connect()
+
+	return ts3Service
+}
+
+// userByUID returns a user with provided ts3 unique id or nil.
+func userByUID(store ts3.Store, uid string) *ts3.User {
+	for _, u := range store.Users() {
+		if u.TS3UID == uid {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// mustUserByUID returns a user with provided ts3 unique id or exits.
+func mustUserByUID(store ts3.Store, uid string) *ts3.User {
+	u := userByUID(store, uid)
+	if u == nil {
+		fmt.Println("No such user")
+		os.Exit(1)
+	}
+
+	return u
+}
+
+// printUsers prints users in the format set by --output.
+func printUsers(users []*ts3.User) {
+	if usersOutput == "json" {
+		if users == nil {
+			users = []*ts3.User{}
+		}
+		j, _ := json.MarshalIndent(users, "", "  ")
+		fmt.Println(string(j))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCHAR ID\tCHARACTER\tCORP\tALLIANCE\tTS3 UID\tCLDBID\tACTIVE\tGUEST")
+	for _, u := range users {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t%s\t%t\t%t\n", u.ID,
+			u.EveCharID, u.EveCharName, u.EveCorpTicker, u.EveAlliTicker,
+			u.TS3UID, u.TS3CLDBID, u.Active, u.Guest)
+	}
+	w.Flush()
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/cobra"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "triggers users validation in a running service",
+	Long: `usage: eve-ts3-service validate
+It will ask the running service to validate users right now.
+Nothing is started if validation is already in progress.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		initConfig()
+		c := system.NewViperConfig()
+
+		resp, err := http.Post("http://"+c.WebServerAddress+
+			"/api/ts3/v1/validateusers", "application/json", nil)
+		system.HandleError(err, "cmd.validate")
+		defer resp.Body.Close()
+
+		var status map[string]string
+		json.NewDecoder(resp.Body).Decode(&status)
+		switch resp.StatusCode {
+		case 202:
+			fmt.Println("Validation started")
+		case 409:
+			fmt.Println("Validation is already in progress")
+		case 503:
+			fmt.Println("This instance is not the leader, run the command " +
+				"against the leader")
+		default:
+			fmt.Println("Unexpected response:", resp.StatusCode, status)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
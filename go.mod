@@ -2,6 +2,7 @@ module github.com/prusya/eve-ts3-service
 
 require (
 	github.com/darfk/ts3 v0.0.0-20170811040620-32e6bdd46a2d
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/gorilla/mux v1.7.0
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/jmoiron/sqlx v1.2.0
@@ -0,0 +1,225 @@
+package esi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBaseURL is the address of EVE Swagger Interface.
+	DefaultBaseURL = "https://esi.evetech.net/latest"
+
+	// affiliationBatchSize is the max number of character ids accepted
+	// by `characters/affiliation` in one request.
+	affiliationBatchSize = 1000
+	userAgent            = "eve-ts3-service (github.com/prusya/eve-ts3-service)"
+)
+
+// Client is a minimal client for public ESI endpoints.
+// Responses to GET requests are cached until they expire and revalidated
+// with ETag afterwards.
+type Client struct {
+	baseURL string
+	client  *http.Client
+	cache   map[string]*cacheEntry
+	lock    sync.Mutex
+}
+
+// cacheEntry is a cached response body.
+type cacheEntry struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// Affiliation is a character's corporation and alliance.
+// AllianceID is 0 if the corporation is not in an alliance.
+type Affiliation struct {
+	CharacterID   int32 `json:"character_id"`
+	CorporationID int32 `json:"corporation_id"`
+	AllianceID    int32 `json:"alliance_id"`
+}
+
+// Corporation is public information about a corporation.
+type Corporation struct {
+	Name       string `json:"name"`
+	Ticker     string `json:"ticker"`
+	AllianceID int32  `json:"alliance_id"`
+}
+
+// Alliance is public information about an alliance.
+type Alliance struct {
+	Name   string `json:"name"`
+	Ticker string `json:"ticker"`
+}
+
+// New creates a new Client. Empty baseURL means DefaultBaseURL.
+func New(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &Client{
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		cache:   make(map[string]*cacheEntry),
+	}
+}
+
+// Affiliation returns affiliations of provided characters.
+// Characters are queried in batches of up to 1000 ids.
+func (c *Client) Affiliation(charIDs []int32) ([]Affiliation, error) {
+	var affiliations []Affiliation
+	for start := 0; start < len(charIDs); start += affiliationBatchSize {
+		end := start + affiliationBatchSize
+		if end > len(charIDs) {
+			end = len(charIDs)
+		}
+
+		payload, _ := json.Marshal(charIDs[start:end])
+		req, err := http.NewRequest("POST",
+			c.baseURL+"/characters/affiliation/", bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		var batch []Affiliation
+		err = c.do(req, &batch)
+		if err != nil {
+			return nil, errors.Wrap(err, "characters/affiliation")
+		}
+		affiliations = append(affiliations, batch...)
+	}
+
+	return affiliations, nil
+}
+
+// Corporation returns public information about a corporation.
+func (c *Client) Corporation(id int32) (*Corporation, error) {
+	var corp Corporation
+	err := c.get(fmt.Sprintf("/corporations/%d/", id), &corp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "corporations/%d", id)
+	}
+
+	return &corp, nil
+}
+
+// Alliance returns public information about an alliance.
+func (c *Client) Alliance(id int32) (*Alliance, error) {
+	var alli Alliance
+	err := c.get(fmt.Sprintf("/alliances/%d/", id), &alli)
+	if err != nil {
+		return nil, errors.Wrapf(err, "alliances/%d", id)
+	}
+
+	return &alli, nil
+}
+
+// Resolve returns affiliation's corporation and alliance.
+// Alliance is empty if the corporation is not in an alliance.
+func (c *Client) Resolve(a Affiliation) (*Corporation, *Alliance, error) {
+	corp, err := c.Corporation(a.CorporationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if a.AllianceID == 0 {
+		return corp, &Alliance{}, nil
+	}
+	alli, err := c.Alliance(a.AllianceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return corp, alli, nil
+}
+
+// get sends GET request to path and decodes json response into v.
+// Cached response is used while it is not expired.
+func (c *Client) get(path string, v interface{}) error {
+	c.lock.Lock()
+	entry := c.cache[path]
+	c.lock.Unlock()
+	if entry != nil && time.Now().Before(entry.expires) {
+		return json.Unmarshal(entry.body, v)
+	}
+
+	req, err := http.NewRequest("GET", c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if entry != nil && entry.etag != "" {
+		req.Header.Set("If-None-Match", entry.etag)
+	}
+
+	resp, body, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		body = entry.body
+	case resp.StatusCode != 200:
+		return errors.Errorf("non 200 response: %d", resp.StatusCode)
+	}
+
+	c.lock.Lock()
+	c.cache[path] = &cacheEntry{
+		body:    body,
+		etag:    resp.Header.Get("ETag"),
+		expires: expires(resp.Header),
+	}
+	c.lock.Unlock()
+
+	return json.Unmarshal(body, v)
+}
+
+// do sends req and decodes json response into v.
+func (c *Client) do(req *http.Request, v interface{}) error {
+	resp, body, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return errors.Errorf("non 200 response: %d", resp.StatusCode)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// send sends req and reads response body.
+func (c *Client) send(req *http.Request) (*http.Response, []byte, error) {
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, body, nil
+}
+
+// expires returns the time when a response with provided headers expires.
+// Missing or malformed Expires header means the response is expired already.
+func expires(h http.Header) time.Time {
+	t, err := http.ParseTime(h.Get("Expires"))
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
@@ -0,0 +1,131 @@
+package esi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newStubESI creates a server answering like ESI for a few known ids.
+func newStubESI(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/characters/affiliation/", func(w http.ResponseWriter,
+		r *http.Request) {
+		var ids []int32
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&ids))
+		var resp []Affiliation
+		for _, id := range ids {
+			resp = append(resp, Affiliation{
+				CharacterID:   id,
+				CorporationID: 100,
+				AllianceID:    200,
+			})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/corporations/100/", func(w http.ResponseWriter,
+		r *http.Request) {
+		fmt.Fprint(w, `{"name":"Corp","ticker":"CORP","alliance_id":200}`)
+	})
+	mux.HandleFunc("/alliances/200/", func(w http.ResponseWriter,
+		r *http.Request) {
+		fmt.Fprint(w, `{"name":"Alliance","ticker":"ALLI"}`)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestNew(t *testing.T) {
+	require.Equal(t, DefaultBaseURL, New("").baseURL)
+	require.Equal(t, "http://esi", New("http://esi").baseURL)
+}
+
+func TestClient(t *testing.T) {
+	server := newStubESI(t)
+	defer server.Close()
+	c := New(server.URL)
+
+	t.Run("TestAffiliation", func(t *testing.T) {
+		ids := make([]int32, affiliationBatchSize+1)
+		for i := range ids {
+			ids[i] = int32(i + 1)
+		}
+		affiliations, err := c.Affiliation(ids)
+		require.Nil(t, err)
+		require.Len(t, affiliations, len(ids))
+		require.Equal(t, Affiliation{CharacterID: 1, CorporationID: 100,
+			AllianceID: 200}, affiliations[0])
+	})
+
+	t.Run("TestCorporation", func(t *testing.T) {
+		corp, err := c.Corporation(100)
+		require.Nil(t, err)
+		require.Equal(t, "CORP", corp.Ticker)
+		require.Equal(t, int32(200), corp.AllianceID)
+
+		_, err = c.Corporation(101)
+		require.NotNil(t, err)
+	})
+
+	t.Run("TestAlliance", func(t *testing.T) {
+		alli, err := c.Alliance(200)
+		require.Nil(t, err)
+		require.Equal(t, "ALLI", alli.Ticker)
+	})
+
+	t.Run("TestResolve", func(t *testing.T) {
+		corp, alli, err := c.Resolve(Affiliation{CorporationID: 100,
+			AllianceID: 200})
+		require.Nil(t, err)
+		require.Equal(t, "CORP", corp.Ticker)
+		require.Equal(t, "ALLI", alli.Ticker)
+
+		_, alli, err = c.Resolve(Affiliation{CorporationID: 100})
+		require.Nil(t, err)
+		require.Equal(t, "", alli.Ticker)
+	})
+}
+
+func TestCache(t *testing.T) {
+	requests := 0
+	revalidated := 0
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				revalidated++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			if r.URL.Path == "/alliances/200/" {
+				w.Header().Set("Expires",
+					time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+			}
+			fmt.Fprint(w, `{"name":"Name","ticker":"TICK"}`)
+		}))
+	defer server.Close()
+	c := New(server.URL)
+
+	// Not expired response is served from cache.
+	for i := 0; i < 2; i++ {
+		alli, err := c.Alliance(200)
+		require.Nil(t, err)
+		require.Equal(t, "TICK", alli.Ticker)
+	}
+	require.Equal(t, 1, requests)
+
+	// Expired response is revalidated with ETag.
+	for i := 0; i < 2; i++ {
+		corp, err := c.Corporation(100)
+		require.Nil(t, err)
+		require.Equal(t, "TICK", corp.Ticker)
+	}
+	require.Equal(t, 3, requests)
+	require.Equal(t, 1, revalidated)
+}
@@ -2,6 +2,7 @@ package gorillahttp
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"time"
@@ -30,7 +31,7 @@ func New(system *system.System) *Service {
 		system: system,
 		router: r,
 		server: &http.Server{
-			Addr:         system.Config.WebServerAddress,
+			Addr:         system.Config().WebServerAddress,
 			Handler:      r,
 			ReadTimeout:  10 * time.Second,
 			WriteTimeout: 10 * time.Second,
@@ -45,10 +46,15 @@ func New(system *system.System) *Service {
 }
 
 // Start starts the Service.
+// The listener is bound before Start returns, so requests can be sent
+// right after the call.
 func (s *Service) Start() {
+	l, err := net.Listen("tcp", s.server.Addr)
+	system.HandleError(err, serviceName+".Start")
+
 	go func() {
 		defer s.recoverPanic()
-		err := s.server.ListenAndServe()
+		err := s.server.Serve(l)
 		if err != nil {
 			if err != http.ErrServerClosed {
 				system.HandleError(err, serviceName+".Start")
@@ -63,9 +69,15 @@ func (s *Service) recoverPanic() {
 	}
 }
 
-// Stop stops the Service.
+// Stop stops the Service giving requests in progress 5 seconds to finish.
 func (s *Service) Stop() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	s.server.Shutdown(ctx)
+	s.Shutdown(ctx)
+}
+
+// Shutdown stops accepting requests and waits for requests in progress
+// until ctx is done.
+func (s *Service) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
 }
@@ -10,22 +10,18 @@ import (
 )
 
 func TestNew(t *testing.T) {
-	sys := &system.System{
-		Config: &system.Config{
-			WebServerAddress: ":8080",
-		},
-	}
+	sys := system.NewWithConfig(&system.Config{
+		WebServerAddress: ":8080",
+	})
 	httpservice := New(sys)
 	require.Equal(t, sys.HTTP, httpservice)
 	require.Equal(t, ":8080", httpservice.server.Addr)
 }
 
 func TestStartStop(t *testing.T) {
-	sys := &system.System{
-		Config: &system.Config{
-			WebServerAddress: ":8083",
-		},
-	}
+	sys := system.NewWithConfig(&system.Config{
+		WebServerAddress: ":8083",
+	})
 	httpservice := New(sys)
 
 	httpservice.Start()
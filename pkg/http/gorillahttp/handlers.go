@@ -2,13 +2,19 @@ package gorillahttp
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
 
 	"github.com/prusya/eve-ts3-service/pkg/system"
 	"github.com/prusya/eve-ts3-service/pkg/ts3"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/dump"
 )
 
 type eveChar struct {
@@ -54,6 +60,12 @@ func respond403(w http.ResponseWriter) {
 	respondWithError(w, 403, http.StatusText(403))
 }
 
+// respond503NotLeader responds with http Service Unavailable 503 to requests
+// which only the leader replica can serve.
+func respond503NotLeader(w http.ResponseWriter) {
+	respondWithError(w, 503, "not the leader")
+}
+
 // NotFoundH responds with http Not Found 404.
 func NotFoundH(w http.ResponseWriter, r *http.Request) {
 	respondWithError(w, 404, http.StatusText(404))
@@ -86,13 +98,403 @@ func (s *Service) CreateRegisterRecordH(w http.ResponseWriter, r *http.Request)
 	user := ts3.User{
 		EveCharID:     eu.EveCharID,
 		EveCharName:   eu.EveCharName,
+		EveCorpID:     eu.EveCorpID,
+		EveCorpName:   eu.EveCorpName,
 		EveCorpTicker: eu.EveCorpTicker,
+		EveAlliID:     eu.EveAlliID,
+		EveAlliName:   eu.EveAlliName,
 		EveAlliTicker: eu.EveAlliTicker,
 		Active:        true,
+		Guest:         r.URL.Query().Get("guest") == "true",
+	}
+	// Guests are not validated, so members can't register as guests.
+	if user.Guest {
+		for _, u := range s.system.TS3.GetStore().UsersByCharID(user.EveCharID) {
+			if u.Active && !u.Guest {
+				respondWithError(w, 409, "character is already a member")
+				return
+			}
+		}
 	}
 	s.system.TS3.CreateRegisterRecord(&user)
 
-	respondWithJSON(w, 200, s.system.Config.TS3RegisterTimer)
+	respondWithJSON(w, 200, s.system.Config().TS3RegisterTimer)
+}
+
+// maxRegistrationWait caps long-poll of RegistrationStatusH to stay
+// within the server's WriteTimeout.
+const maxRegistrationWait = 8 * time.Second
+
+// RegistrationStatusH responds with a status of eve character's
+// registration. With `wait` query parameter set to a number of seconds,
+// a pending registration is awaited that long before responding.
+func (s *Service) RegistrationStatusH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	charID, err := strconv.ParseInt(mux.Vars(r)["charID"], 10, 32)
+	if err != nil {
+		respondWithError(w, 400, "invalid charID")
+		return
+	}
+
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			respondWithError(w, 400, "invalid wait")
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+		if wait > maxRegistrationWait {
+			wait = maxRegistrationWait
+		}
+	}
+
+	st, ok := s.system.TS3.RegistrationStatus(int32(charID), wait)
+	if !ok {
+		respondWithError(w, 404, "no registration for this character")
+		return
+	}
+	if st.Groups == nil {
+		st.Groups = []string{}
+	}
+
+	respondWithJSON(w, 200, st)
+}
+
+// TriggerValidateUsersH starts users validation unless it is already
+// in progress.
+func (s *Service) TriggerValidateUsersH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	if !s.system.TS3.Leader() {
+		respond503NotLeader(w)
+		return
+	}
+	if !s.system.TS3.TriggerValidateUsers() {
+		respondWithJSON(w, 409, map[string]string{"status": "in progress"})
+		return
+	}
+
+	respondWithJSON(w, 202, map[string]string{"status": "started"})
+}
+
+// ValidateUsersStatusH reports whether users validation is in progress.
+func (s *Service) ValidateUsersStatusH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	respondWithJSON(w, 200, map[string]bool{
+		"running": s.system.TS3.ValidateUsersRunning(),
+	})
+}
+
+// LeaderH reports whether this replica is the leader which holds ts3
+// connection and runs periodic jobs.
+func (s *Service) LeaderH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	respondWithJSON(w, 200, map[string]bool{
+		"leader": s.system.TS3.Leader(),
+	})
+}
+
+// validSecret checks whether r carries secret as a bearer token.
+// Empty secret is never valid.
+func validSecret(r *http.Request, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	token := []byte("Bearer " + secret)
+	header := []byte(r.Header.Get("Authorization"))
+
+	return subtle.ConstantTimeCompare(header, token) == 1
+}
+
+// validAdmin checks whether r carries configured AdminSecret.
+func (s *Service) validAdmin(r *http.Request) bool {
+	return validSecret(r, s.system.Config().AdminSecret)
+}
+
+// UserStatusH applies a status of an eve character pushed by the
+// validation server.
+func (s *Service) UserStatusH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	if !validSecret(r, s.system.Config().UserStatusSecret) {
+		respond401(w)
+		return
+	}
+	charID, err := strconv.ParseInt(mux.Vars(r)["charID"], 10, 32)
+	if err != nil {
+		respondWithError(w, 400, "invalid charID")
+		return
+	}
+
+	var st ts3.UserStatus
+	err = json.NewDecoder(r.Body).Decode(&st)
+	if err != nil {
+		respondWithError(w, 400, "invalid json")
+		return
+	}
+	st.EveCharID = int32(charID)
+	if st.Valid && st.EveCorpTicker == "" {
+		respondWithError(w, 400, "EveCorpTicker is required for valid users")
+		return
+	}
+
+	if !s.system.TS3.Leader() {
+		respond503NotLeader(w)
+		return
+	}
+	if s.system.TS3.ApplyUserStatus(st) == 0 {
+		respondWithError(w, 404, "no active users for this character")
+		return
+	}
+
+	respondOK(w)
+}
+
+// AuditEventsH responds with all audit events.
+func (s *Service) AuditEventsH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	events := s.system.TS3.GetStore().AuditEvents()
+	if events == nil {
+		events = []*ts3.AuditEvent{}
+	}
+
+	respondWithJSON(w, 200, events)
+}
+
+// SetAuditEventReviewedH marks an audit event as reviewed.
+func (s *Service) SetAuditEventReviewedH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, 400, "invalid id")
+		return
+	}
+	s.system.TS3.GetStore().SetAuditEventReviewed(id)
+
+	respondOK(w)
+}
+
+// grantRequest is a body of CreateGrantH request. Either ExpiresAt
+// or Duration in seconds is required.
+type grantRequest struct {
+	SGID      string
+	TS3UID    string
+	EveCharID int32
+	Reason    string
+	StartsAt  int64
+	ExpiresAt int64
+	Duration  int64
+}
+
+// GrantsH responds with all grants.
+func (s *Service) GrantsH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	grants := s.system.TS3.GetStore().Grants()
+	if grants == nil {
+		grants = []*ts3.Grant{}
+	}
+
+	respondWithJSON(w, 200, grants)
+}
+
+// CreateGrantH creates a time limited server group membership.
+// Protected groups and the reference group can't be granted.
+func (s *Service) CreateGrantH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	if !s.validAdmin(r) {
+		respond401(w)
+		return
+	}
+	var req grantRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		respondWithError(w, 400, "invalid json")
+		return
+	}
+	if req.SGID == "" {
+		respondWithError(w, 400, "SGID is required")
+		return
+	}
+	if (req.TS3UID == "") == (req.EveCharID == 0) {
+		respondWithError(w, 400, "exactly one of TS3UID and EveCharID is required")
+		return
+	}
+
+	start := req.StartsAt
+	if start == 0 {
+		start = time.Now().Unix()
+	}
+	if req.ExpiresAt == 0 && req.Duration > 0 {
+		req.ExpiresAt = start + req.Duration
+	}
+	if req.ExpiresAt <= start {
+		respondWithError(w, 400, "grant must expire after it starts")
+		return
+	}
+
+	g := ts3.Grant{
+		SGID:      req.SGID,
+		TS3UID:    req.TS3UID,
+		EveCharID: req.EveCharID,
+		Reason:    req.Reason,
+		StartsAt:  req.StartsAt,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if !s.system.TS3.CreateGrant(&g) {
+		respondWithError(w, 403, "this group can't be granted")
+		return
+	}
+
+	respondWithJSON(w, 201, g)
+}
+
+// RevokeGrantH expires a grant right away.
+func (s *Service) RevokeGrantH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	if !s.validAdmin(r) {
+		respond401(w)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, 400, "invalid id")
+		return
+	}
+	if !s.system.TS3.RevokeGrant(id) {
+		respondWithError(w, 404, "no active grant with this id")
+		return
+	}
+
+	respondOK(w)
+}
+
+// GuestRequestsH responds with all guest requests.
+func (s *Service) GuestRequestsH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	requests := s.system.TS3.GetStore().GuestRequests()
+	if requests == nil {
+		requests = []*ts3.GuestRequest{}
+	}
+
+	respondWithJSON(w, 200, requests)
+}
+
+// ApproveGuestH approves a pending guest request.
+func (s *Service) ApproveGuestH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	if !s.validAdmin(r) {
+		respond401(w)
+		return
+	}
+	if s.system.Config().TS3GuestGroupID == "" {
+		respondWithError(w, 409, "guest group is not configured")
+		return
+	}
+	s.decideGuest(w, r, s.system.TS3.ApproveGuest)
+}
+
+// DenyGuestH denies a pending guest request.
+func (s *Service) DenyGuestH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	if !s.validAdmin(r) {
+		respond401(w)
+		return
+	}
+	s.decideGuest(w, r, s.system.TS3.DenyGuest)
+}
+
+// decideGuest applies decide to a guest request from the url.
+// Optional body `{"By": "name"}` tells who made the decision.
+func (s *Service) decideGuest(w http.ResponseWriter, r *http.Request,
+	decide func(id int, by string) bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, 400, "invalid id")
+		return
+	}
+	body := struct{ By string }{}
+	json.NewDecoder(r.Body).Decode(&body)
+	if body.By == "" {
+		body.By = "api"
+	}
+
+	if !decide(id, body.By) {
+		respondWithError(w, 404, "no pending guest request with this id")
+		return
+	}
+
+	respondOK(w)
+}
+
+// ExportH responds with a dump of all records.
+// Query parameter `format` is json (default) or csv, csv dumps need
+// `kind` to be one of users, groups, grants, guests, audit.
+func (s *Service) ExportH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	if !s.validAdmin(r) {
+		respond401(w)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	kind := r.URL.Query().Get("kind")
+	switch format {
+	case "", "json":
+	case "csv":
+		if !dump.IsKind(kind) {
+			respondWithError(w, 400, "invalid kind")
+			return
+		}
+	default:
+		respondWithError(w, 400, "invalid format")
+		return
+	}
+
+	d := dump.Export(s.system.TS3.GetStore())
+	if format != "csv" {
+		respondWithJSON(w, 200, d)
+		return
+	}
+
+	var buf bytes.Buffer
+	err := d.WriteCSV(&buf, kind)
+	system.HandleError(err, serviceName+".ExportH")
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(200)
+	w.Write(buf.Bytes())
+}
+
+// ReloadConfigH rereads the config file and applies fields which can
+// change without a restart. It responds with lists of applied fields and
+// fields which need a restart.
+func (s *Service) ReloadConfigH(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w)
+
+	if !s.validAdmin(r) {
+		respond401(w)
+		return
+	}
+	reload, err := s.system.ReloadConfigFile()
+	system.LogConfigReload("admin request", reload, err)
+	if _, ok := err.(system.ConfigError); ok {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	system.HandleError(err, serviceName+".ReloadConfigH")
+
+	respondWithJSON(w, 200, reload)
 }
 
 // deserializeEveChar converts base64 encoded json with eve char data into struct.
@@ -4,10 +4,13 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
 	"github.com/prusya/eve-ts3-service/pkg/ts3/darfkts3service"
 	"github.com/prusya/eve-ts3-service/pkg/ts3/pgts3store"
 	"github.com/stretchr/testify/require"
@@ -34,15 +37,12 @@ func TestDeserializeEveChar(t *testing.T) {
 }
 
 func TestCreateRegisterRecord(t *testing.T) {
-	sys := &system.System{
-		Config: &system.Config{
-			WebServerAddress: ":8081",
-			TS3RegisterTimer: 300,
-		},
-	}
-	db := &sqlx.DB{}
-	store := pgts3store.New(db)
-	darfkts3service.New(sys, store)
+	sys := system.NewWithConfig(&system.Config{
+		WebServerAddress: ":8081",
+		TS3RegisterTimer: 300,
+	})
+	store := &registrationStore{}
+	darfkts3service.New(sys, store, nil)
 	httpservice := New(sys)
 
 	httpservice.Start()
@@ -68,5 +68,353 @@ func TestCreateRegisterRecord(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, 200, resp.StatusCode)
 	resp.Body.Close()
+
+	url := "http://localhost:8081/api/ts3/v1/registration/1/status?wait=1"
+	resp, err = http.Get(url)
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	var st ts3.RegistrationStatus
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&st))
+	resp.Body.Close()
+	require.Equal(t, ts3.RegistrationPending, st.Status)
+
+	resp, err = http.Get("http://localhost:8081/api/ts3/v1/registration/2/status")
+	require.Nil(t, err)
+	require.Equal(t, 404, resp.StatusCode)
+	resp.Body.Close()
+
+	// Members can't register as guests.
+	store.users = []*ts3.User{{EveCharID: 1, Active: true}}
+	req, _ = http.NewRequest("GET",
+		"http://localhost:8081/api/ts3/v1/createregisterrecord?guest=true", nil)
+	req.AddCookie(&http.Cookie{
+		Name:  "char",
+		Value: data,
+	})
+	resp, err = http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 409, resp.StatusCode)
+	resp.Body.Close()
+	require.Len(t, store.registrations, 1)
 	httpservice.Stop()
 }
+
+// registrationStore keeps registrations and users in memory. Methods not
+// overridden panic through the nil embedded interface.
+type registrationStore struct {
+	ts3.Store
+	users         []*ts3.User
+	lock          sync.Mutex
+	registrations []*ts3.Registration
+}
+
+func (s *registrationStore) UsersByCharID(charID int32) []*ts3.User {
+	var users []*ts3.User
+	for _, u := range s.users {
+		if u.EveCharID == charID {
+			users = append(users, u)
+		}
+	}
+
+	return users
+}
+
+func (s *registrationStore) CreateRegistration(r *ts3.Registration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r.ID = len(s.registrations) + 1
+	s.registrations = append([]*ts3.Registration{r}, s.registrations...)
+}
+
+func (s *registrationStore) Registrations(since int64) []*ts3.Registration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.registrations
+}
+
+func TestValidateUsersH(t *testing.T) {
+	sys := system.NewWithConfig(&system.Config{
+		WebServerAddress: ":8084",
+	})
+	db := &sqlx.DB{}
+	store := pgts3store.New(db)
+	darfkts3service.New(sys, store, nil)
+	httpservice := New(sys)
+
+	httpservice.Start()
+	defer httpservice.Stop()
+
+	// The service was not started, so it's not the leader.
+	resp, err := http.Get("http://localhost:8084/api/ts3/v1/leader")
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	var leader map[string]bool
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&leader))
+	resp.Body.Close()
+	require.False(t, leader["leader"])
+
+	resp, err = http.Post("http://localhost:8084/api/ts3/v1/validateusers",
+		"application/json", nil)
+	require.Nil(t, err)
+	require.Equal(t, 503, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.Get("http://localhost:8084/api/ts3/v1/validateusers")
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestTriggerValidateUsersH(t *testing.T) {
+	sys := system.NewWithConfig(&system.Config{
+		WebServerAddress: ":8089",
+	})
+	ts3service := &validateService{}
+	sys.TS3 = ts3service
+	httpservice := New(sys)
+
+	httpservice.Start()
+	defer httpservice.Stop()
+
+	url := "http://localhost:8089/api/ts3/v1/validateusers"
+	trigger := func() int {
+		resp, err := http.Post(url, "application/json", nil)
+		require.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	running := func() bool {
+		resp, err := http.Get(url)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		var status map[string]bool
+		require.Nil(t, json.NewDecoder(resp.Body).Decode(&status))
+		return status["running"]
+	}
+
+	// The first run is held until finished, so the second is rejected.
+	require.Equal(t, 202, trigger())
+	require.True(t, running())
+	require.Equal(t, 409, trigger())
+
+	ts3service.finish()
+	require.False(t, running())
+	require.Equal(t, 202, trigger())
+}
+
+func TestUserStatusH(t *testing.T) {
+	sys := system.NewWithConfig(&system.Config{
+		WebServerAddress: ":8085",
+		UserStatusSecret: "secret",
+	})
+	ts3service := &statusService{}
+	sys.TS3 = ts3service
+	httpservice := New(sys)
+
+	httpservice.Start()
+	defer httpservice.Stop()
+
+	url := "http://localhost:8085/api/ts3/v1/users/1/status"
+	post := func(secret, body string) int {
+		req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Pushes without the secret are rejected before anything else.
+	require.Equal(t, 401, post("", `{"Valid": false}`))
+	require.Equal(t, 401, post("wrong", `{"Valid": false}`))
+	require.Empty(t, ts3service.applied)
+
+	require.Equal(t, 400, post("secret", "not json"))
+	require.Equal(t, 400, post("secret", `{"Valid": true}`))
+
+	require.Equal(t, 200, post("secret",
+		`{"Valid": true, "EveCorpTicker": "CORP"}`))
+	require.Equal(t, []ts3.UserStatus{
+		{EveCharID: 1, Valid: true, EveCorpTicker: "CORP"},
+	}, ts3service.applied)
+
+	// Empty secret rejects every push.
+	req, _ := http.NewRequest("POST", url, nil)
+	require.False(t, validSecret(req, ""))
+	req.Header.Set("Authorization", "Bearer ")
+	require.False(t, validSecret(req, ""))
+}
+
+// statusService is a leader which records applied statuses. Methods not
+// overridden panic through the nil embedded interface.
+type statusService struct {
+	ts3.Service
+	applied []ts3.UserStatus
+}
+
+func (s *statusService) Leader() bool {
+	return true
+}
+
+func (s *statusService) ApplyUserStatus(st ts3.UserStatus) int {
+	s.applied = append(s.applied, st)
+	return 1
+}
+
+// validateService is a leader whose users validation keeps running until
+// finish is called.
+type validateService struct {
+	ts3.Service
+	lock    sync.Mutex
+	running bool
+}
+
+func (s *validateService) Leader() bool {
+	return true
+}
+
+func (s *validateService) TriggerValidateUsers() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.running {
+		return false
+	}
+	s.running = true
+
+	return true
+}
+
+func (s *validateService) ValidateUsersRunning() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.running
+}
+
+func (s *validateService) finish() {
+	s.lock.Lock()
+	s.running = false
+	s.lock.Unlock()
+}
+
+// adminRequest sends a request with secret as a bearer token, if it is
+// set, and returns the response code.
+func adminRequest(t *testing.T, method, url, secret, body string) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.Nil(t, err)
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestCreateGrantH(t *testing.T) {
+	sys := system.NewWithConfig(&system.Config{
+		WebServerAddress:     ":8086",
+		AdminSecret:          "secret",
+		TS3ReferenceGroupID:  "7",
+		TS3ProtectedGroupIDs: []string{"6"},
+	})
+	db := &sqlx.DB{}
+	store := pgts3store.New(db)
+	darfkts3service.New(sys, store, nil)
+	httpservice := New(sys)
+
+	httpservice.Start()
+	defer httpservice.Stop()
+
+	url := "http://localhost:8086/api/ts3/v1/grants"
+	valid := `{"SGID": "10", "TS3UID": "uid", "Duration": 60}`
+	require.Equal(t, 401, adminRequest(t, "POST", url, "", valid))
+	require.Equal(t, 401, adminRequest(t, "POST", url, "wrong", valid))
+	require.Equal(t, 401, adminRequest(t, "DELETE", url+"/1", "", ""))
+
+	for _, body := range []string{
+		`not json`,
+		`{"TS3UID": "uid", "Duration": 60}`,
+		`{"SGID": "10", "Duration": 60}`,
+		`{"SGID": "10", "TS3UID": "uid", "EveCharID": 1, "Duration": 60}`,
+		`{"SGID": "10", "TS3UID": "uid"}`,
+	} {
+		require.Equal(t, 400, adminRequest(t, "POST", url, "secret", body),
+			body)
+	}
+
+	// Protected groups and the reference group are never granted.
+	for _, sgid := range []string{"6", "7"} {
+		body := `{"SGID": "` + sgid + `", "TS3UID": "uid", "Duration": 60}`
+		require.Equal(t, 403, adminRequest(t, "POST", url, "secret", body),
+			sgid)
+	}
+}
+
+func TestApproveGuestH(t *testing.T) {
+	sys := system.NewWithConfig(&system.Config{
+		WebServerAddress: ":8087",
+		AdminSecret:      "secret",
+	})
+	db := &sqlx.DB{}
+	store := pgts3store.New(db)
+	darfkts3service.New(sys, store, nil)
+	httpservice := New(sys)
+
+	httpservice.Start()
+	defer httpservice.Stop()
+
+	url := "http://localhost:8087/api/ts3/v1/guests/1/"
+	for _, action := range []string{"approve", "deny"} {
+		require.Equal(t, 401, adminRequest(t, "POST", url+action, "", ""))
+		require.Equal(t, 401, adminRequest(t, "POST", url+action, "wrong", ""))
+	}
+	require.Equal(t, 409, adminRequest(t, "POST", url+"approve", "secret", ""))
+}
+
+func TestExportH(t *testing.T) {
+	sys := system.NewWithConfig(&system.Config{
+		WebServerAddress: ":8088",
+		AdminSecret:      "secret",
+	})
+	db := &sqlx.DB{}
+	store := pgts3store.New(db)
+	darfkts3service.New(sys, store, nil)
+	httpservice := New(sys)
+
+	httpservice.Start()
+	defer httpservice.Stop()
+
+	url := "http://localhost:8088/api/admin/export?"
+	require.Equal(t, 401, adminRequest(t, "GET", url, "", ""))
+	require.Equal(t, 401, adminRequest(t, "GET", url, "wrong", ""))
+	for _, query := range []string{"format=xml", "format=csv",
+		"format=csv&kind=nope"} {
+		require.Equal(t, 400, adminRequest(t, "GET", url+query, "secret", ""),
+			query)
+	}
+}
+
+func TestReloadConfigH(t *testing.T) {
+	sys := system.NewWithConfig(&system.Config{
+		WebServerAddress: ":8090",
+		AdminSecret:      "secret",
+	})
+	db := &sqlx.DB{}
+	store := pgts3store.New(db)
+	darfkts3service.New(sys, store, nil)
+	httpservice := New(sys)
+
+	httpservice.Start()
+	defer httpservice.Stop()
+
+	url := "http://localhost:8090/api/admin/config/reload"
+	require.Equal(t, 401, adminRequest(t, "POST", url, "", ""))
+	require.Equal(t, 401, adminRequest(t, "POST", url, "wrong", ""))
+}
@@ -15,4 +15,26 @@ func (s *Service) Routes() {
 	// ts3 service routes.
 	ts3v1 := jsonAPI.PathPrefix("/ts3/v1").Subrouter()
 	ts3v1.HandleFunc("/createregisterrecord", s.CreateRegisterRecordH)
+	ts3v1.HandleFunc("/registration/{charID:[0-9]+}/status",
+		s.RegistrationStatusH).Methods("GET")
+	ts3v1.HandleFunc("/validateusers", s.TriggerValidateUsersH).Methods("POST")
+	ts3v1.HandleFunc("/validateusers", s.ValidateUsersStatusH).Methods("GET")
+	ts3v1.HandleFunc("/leader", s.LeaderH).Methods("GET")
+	ts3v1.HandleFunc("/users/{charID:[0-9]+}/status",
+		s.UserStatusH).Methods("POST")
+	ts3v1.HandleFunc("/audit/events", s.AuditEventsH).Methods("GET")
+	ts3v1.HandleFunc("/audit/events/{id:[0-9]+}/reviewed",
+		s.SetAuditEventReviewedH).Methods("POST")
+	ts3v1.HandleFunc("/grants", s.GrantsH).Methods("GET")
+	ts3v1.HandleFunc("/grants", s.CreateGrantH).Methods("POST")
+	ts3v1.HandleFunc("/grants/{id:[0-9]+}", s.RevokeGrantH).Methods("DELETE")
+	ts3v1.HandleFunc("/guests", s.GuestRequestsH).Methods("GET")
+	ts3v1.HandleFunc("/guests/{id:[0-9]+}/approve",
+		s.ApproveGuestH).Methods("POST")
+	ts3v1.HandleFunc("/guests/{id:[0-9]+}/deny", s.DenyGuestH).Methods("POST")
+
+	// admin routes.
+	admin := jsonAPI.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/export", s.ExportH).Methods("GET")
+	admin.HandleFunc("/config/reload", s.ReloadConfigH).Methods("POST")
 }
@@ -0,0 +1,14 @@
+package leader
+
+// Elector defines an interface of how replicas of the service agree on
+// a single leader.
+type Elector interface {
+	// Acquire tries to become the leader without waiting.
+	// It reports whether leadership is held.
+	Acquire() bool
+	// Lost returns a channel which is closed when leadership taken by
+	// the last successful Acquire is lost.
+	Lost() <-chan struct{}
+	// Release gives up leadership if it is held.
+	Release()
+}
@@ -0,0 +1,140 @@
+package pgleader
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	electorName = "pgleader"
+	// lockKey identifies the advisory lock. Replicas sharing a database
+	// compete for the same lock.
+	lockKey = 7453339370001
+	// checkInterval is how often the lock connection is checked.
+	checkInterval = 5 * time.Second
+
+	tryLockQuery = `SELECT pg_try_advisory_lock($1)`
+	unlockQuery  = `SELECT pg_advisory_unlock($1)`
+)
+
+// Elector implements leader.Elector interface backed by a postgresql
+// session level advisory lock. The lock is held by a dedicated connection,
+// postgres releases it once the connection is gone.
+type Elector struct {
+	db       *sqlx.DB
+	key      int64
+	interval time.Duration
+
+	lock sync.Mutex
+	conn *sql.Conn
+	lost chan struct{}
+	stop chan struct{}
+}
+
+// New creates a new Elector.
+func New(db *sqlx.DB) *Elector {
+	e := Elector{
+		db:       db,
+		key:      lockKey,
+		interval: checkInterval,
+	}
+
+	return &e
+}
+
+// Acquire tries to take the advisory lock without waiting.
+// It reports whether the lock is held.
+func (e *Elector) Acquire() bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.conn != nil {
+		return true
+	}
+
+	ctx := context.Background()
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		log.Printf("%s: failed to get a connection: %s\n", electorName, err)
+		return false
+	}
+	var locked bool
+	err = conn.QueryRowContext(ctx, tryLockQuery, e.key).Scan(&locked)
+	if err != nil || !locked {
+		if err != nil {
+			log.Printf("%s: failed to take the lock: %s\n", electorName, err)
+		}
+		conn.Close()
+		return false
+	}
+
+	e.conn = conn
+	e.lost = make(chan struct{})
+	e.stop = make(chan struct{})
+	go e.watch(conn, e.lost, e.stop)
+
+	return true
+}
+
+// Lost returns a channel which is closed when the connection holding
+// the lock taken by the last successful Acquire fails.
+func (e *Elector) Lost() <-chan struct{} {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.lost
+}
+
+// Release unlocks the advisory lock if it is held.
+func (e *Elector) Release() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.conn == nil {
+		return
+	}
+	close(e.stop)
+	_, err := e.conn.ExecContext(context.Background(), unlockQuery, e.key)
+	if err != nil {
+		log.Printf("%s: failed to release the lock: %s\n", electorName, err)
+	}
+	e.conn.Close()
+	e.conn = nil
+}
+
+// watch checks conn every interval until stop is closed.
+// Once the check fails, the lock is considered lost and lost is closed.
+func (e *Elector) watch(conn *sql.Conn, lost, stop chan struct{}) {
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+		_, err := conn.ExecContext(ctx, `SELECT 1`)
+		cancel()
+		if err == nil {
+			continue
+		}
+
+		log.Printf("%s: lock connection failed: %s\n", electorName, err)
+		e.lock.Lock()
+		if e.conn == conn {
+			conn.Close()
+			e.conn = nil
+		}
+		e.lock.Unlock()
+		close(lost)
+		return
+	}
+}
@@ -0,0 +1,101 @@
+package pgleader
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// testLockKey differs from lockKey, so tests don't compete with a service
+// using the same database.
+const testLockKey = 7453339370099
+
+func TestNew(t *testing.T) {
+	db := &sqlx.DB{}
+	e := New(db)
+	require.Equal(t, db, e.db)
+
+	// Release is a no-op while the lock is not held.
+	e.Release()
+	require.Nil(t, e.Lost())
+}
+
+// testDB connects to postgres at EVETS3_TEST_PG_CONN_STRING and skips
+// the test if it is not set.
+func testDB(t *testing.T) *sqlx.DB {
+	connString := os.Getenv("EVETS3_TEST_PG_CONN_STRING")
+	if connString == "" {
+		t.Skip("EVETS3_TEST_PG_CONN_STRING is not set")
+	}
+	db, err := sqlx.Connect("postgres", connString)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db
+}
+
+func newTestElector(db *sqlx.DB) *Elector {
+	e := New(db)
+	e.key = testLockKey
+	e.interval = 50 * time.Millisecond
+
+	return e
+}
+
+func TestElector(t *testing.T) {
+	db := testDB(t)
+	first := newTestElector(db)
+	second := newTestElector(db)
+	defer first.Release()
+	defer second.Release()
+
+	require.True(t, first.Acquire())
+	require.NotNil(t, first.Lost())
+	// Acquire while holding the lock keeps it.
+	require.True(t, first.Acquire())
+
+	// The lock is held by a session, so another connection doesn't get it.
+	require.False(t, second.Acquire())
+	require.Nil(t, second.Lost())
+
+	// Release unlocks, so the other elector takes over.
+	first.Release()
+	require.True(t, second.Acquire())
+	require.False(t, first.Acquire())
+}
+
+func TestElectorConnectionLost(t *testing.T) {
+	db := testDB(t)
+	first := newTestElector(db)
+	second := newTestElector(db)
+	defer first.Release()
+	defer second.Release()
+
+	require.True(t, first.Acquire())
+	lost := first.Lost()
+	var pid int
+	err := first.conn.QueryRowContext(context.Background(),
+		`SELECT pg_backend_pid()`).Scan(&pid)
+	require.Nil(t, err)
+
+	// Postgres releases the lock of a terminated session.
+	_, err = db.Exec(`SELECT pg_terminate_backend($1)`, pid)
+	require.Nil(t, err)
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lost is not closed")
+	}
+	require.True(t, second.Acquire())
+
+	// Release after the loss doesn't touch the lock of another elector.
+	first.Release()
+	require.False(t, first.Acquire())
+}
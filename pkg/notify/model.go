@@ -0,0 +1,29 @@
+package notify
+
+// Event types which can be used in sink filters.
+const (
+	UserRemoved           = "user_removed"
+	CorpChanged           = "corp_changed"
+	RegistrationCompleted = "registration_completed"
+	ValidationFailed      = "validation_failed"
+	ConnectionLost        = "connection_lost"
+	Reconnected           = "reconnected"
+	GuestRequested        = "guest_requested"
+)
+
+// Event represents something happened in the services which may be
+// of interest to people.
+type Event struct {
+	Type string
+	// At is a unix timestamp.
+	At      int64
+	Message string
+	Fields  map[string]string
+}
+
+// Service defines an interface of how to interact with notify service.
+type Service interface {
+	Start()
+	Stop()
+	Notify(e Event)
+}
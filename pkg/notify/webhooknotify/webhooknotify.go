@@ -0,0 +1,212 @@
+package webhooknotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/prusya/eve-ts3-service/pkg/notify"
+	"github.com/prusya/eve-ts3-service/pkg/system"
+)
+
+const (
+	serviceName = "webhooknotify"
+
+	sinkWebhook = "webhook"
+	sinkDiscord = "discord"
+	sinkSlack   = "slack"
+
+	defaultQueueSize = 100
+	retryBackoff     = time.Second
+)
+
+// Service implements notify.Service interface by posting events to
+// webhooks.
+type Service struct {
+	system   *system.System
+	client   *http.Client
+	queue    chan notify.Event
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New creates a new Service and prepares it to Start.
+func New(system *system.System) *Service {
+	size := system.Config().NotifyQueueSize
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+
+	s := Service{
+		system:   system,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan notify.Event, size),
+		stopChan: make(chan struct{}),
+	}
+
+	s.system.Notify = &s
+
+	return &s
+}
+
+// Start starts delivering events.
+func (s *Service) Start() {
+	s.wg.Add(1)
+	go s.worker()
+}
+
+// Stop stops delivering events. Queued events are discarded.
+func (s *Service) Stop() {
+	s.Shutdown(context.Background())
+}
+
+// Shutdown stops delivering events and waits for a delivery in progress
+// until ctx is done. Queued events are discarded.
+func (s *Service) Shutdown(ctx context.Context) error {
+	close(s.stopChan)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify queues e for delivery. The event is dropped if the queue is full.
+func (s *Service) Notify(e notify.Event) {
+	if e.At == 0 {
+		e.At = time.Now().Unix()
+	}
+
+	select {
+	case s.queue <- e:
+	default:
+		log.Printf("%s: queue is full, dropping %s event\n", serviceName, e.Type)
+	}
+}
+
+// worker delivers queued events until the service is stopped.
+func (s *Service) worker() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case e := <-s.queue:
+			s.deliver(e)
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// deliver sends e to every sink interested in it.
+func (s *Service) deliver(e notify.Event) {
+	for _, sink := range s.system.Config().NotifySinks {
+		if !wants(sink, e.Type) {
+			continue
+		}
+
+		payload, err := format(sink.Type, e)
+		if err != nil {
+			log.Printf("%s: %s\n", serviceName, err)
+			continue
+		}
+		err = s.send(sink.URL, payload)
+		if err != nil {
+			log.Printf("%s: failed to deliver %s event to %s: %s\n",
+				serviceName, e.Type, sink.Type, err)
+		}
+	}
+}
+
+// send posts payload to url retrying with a growing delay
+// up to NotifyRetries times.
+func (s *Service) send(url string, payload []byte) error {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.post(url, payload)
+		if err == nil || attempt >= s.system.Config().NotifyRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-s.stopChan:
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// post posts json payload to url.
+func (s *Service) post(url string, payload []byte) error {
+	resp, err := s.client.Post(url, "application/json",
+		bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("non 2xx response: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// wants checks whether sink accepts events of provided type.
+func wants(sink system.NotifySink, eventType string) bool {
+	if len(sink.Events) == 0 {
+		return true
+	}
+	for _, t := range sink.Events {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// format converts e into a payload of sink type.
+func format(sinkType string, e notify.Event) ([]byte, error) {
+	switch sinkType {
+	case sinkWebhook:
+		return json.Marshal(e)
+	case sinkDiscord:
+		return json.Marshal(map[string]string{"content": text(e)})
+	case sinkSlack:
+		return json.Marshal(map[string]string{"text": text(e)})
+	}
+
+	return nil, errors.Errorf("unknown sink type %q", sinkType)
+}
+
+// text renders e as a human readable message.
+func text(e notify.Event) string {
+	lines := []string{fmt.Sprintf("[%s] %s", e.Type, e.Message)}
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("%s: %s", k, e.Fields[k]))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,96 @@
+package webhooknotify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/notify"
+	"github.com/prusya/eve-ts3-service/pkg/system"
+)
+
+func TestNew(t *testing.T) {
+	sys := system.NewWithConfig(&system.Config{})
+	notifyservice := New(sys)
+	require.Equal(t, sys.Notify, notifyservice)
+	require.Equal(t, defaultQueueSize, cap(notifyservice.queue))
+}
+
+func TestFormat(t *testing.T) {
+	e := notify.Event{
+		Type:    notify.UserRemoved,
+		Message: "user removed",
+		Fields:  map[string]string{"b": "2", "a": "1"},
+	}
+
+	payload, err := format(sinkDiscord, e)
+	require.Nil(t, err)
+	require.JSONEq(t, `{"content":"[user_removed] user removed\na: 1\nb: 2"}`,
+		string(payload))
+
+	payload, err = format(sinkSlack, e)
+	require.Nil(t, err)
+	require.JSONEq(t, `{"text":"[user_removed] user removed\na: 1\nb: 2"}`,
+		string(payload))
+
+	payload, err = format(sinkWebhook, e)
+	require.Nil(t, err)
+	var decoded notify.Event
+	require.Nil(t, json.Unmarshal(payload, &decoded))
+	require.Equal(t, e, decoded)
+
+	_, err = format("unknown", e)
+	require.NotNil(t, err)
+}
+
+func TestWants(t *testing.T) {
+	require.True(t, wants(system.NotifySink{}, notify.Reconnected))
+	sink := system.NotifySink{Events: []string{notify.UserRemoved}}
+	require.True(t, wants(sink, notify.UserRemoved))
+	require.False(t, wants(sink, notify.Reconnected))
+}
+
+func TestDelivery(t *testing.T) {
+	received := make(chan string, 10)
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if failures > 0 {
+				failures--
+				w.WriteHeader(500)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			received <- string(body)
+		}))
+	defer server.Close()
+
+	sys := system.NewWithConfig(&system.Config{
+		NotifySinks: []system.NotifySink{
+			{
+				Type:   sinkSlack,
+				URL:    server.URL,
+				Events: []string{notify.UserRemoved},
+			},
+		},
+		NotifyRetries: 1,
+	})
+	notifyservice := New(sys)
+	notifyservice.Start()
+	defer notifyservice.Stop()
+
+	notifyservice.Notify(notify.Event{Type: notify.Reconnected, Message: "skip"})
+	notifyservice.Notify(notify.Event{Type: notify.UserRemoved, Message: "bye"})
+
+	select {
+	case body := <-received:
+		require.JSONEq(t, `{"text":"[user_removed] bye"}`, body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+}
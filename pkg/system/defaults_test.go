@@ -0,0 +1,37 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDefaults(t *testing.T) {
+	defer viper.Reset()
+
+	SetDefaults()
+	env := map[string]string{
+		"EVETS3_WEB_SERVER_ADDRESS":  "0.0.0.0:8083",
+		"EVETS3_TS3_PASSWORD":        "secret",
+		"EVETS3_TS3_REMOVAL_RULES":   `[{"Action": "kick"}]`,
+		"EVETS3_TS3_CREATE_CHANNELS": "true",
+	}
+	err := ApplyEnv(func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	require.Nil(t, err)
+
+	c := NewViperConfig()
+	require.Equal(t, "0.0.0.0:8083", c.WebServerAddress)
+	require.Equal(t, "secret", c.TS3Password)
+	require.Equal(t, []RemovalRule{{Action: "kick"}}, c.TS3RemovalRules)
+	require.True(t, c.TS3CreateChannels)
+
+	// Fields without variables keep default values.
+	d := DefaultConfig()
+	require.Equal(t, d.TS3Address, c.TS3Address)
+	require.Equal(t, d.TS3ProtectedGroupIDs, c.TS3ProtectedGroupIDs)
+	require.Equal(t, d.ShutdownTimeout, c.ShutdownTimeout)
+}
@@ -0,0 +1,115 @@
+package system
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is a prefix of environment variables overriding Config fields.
+const EnvPrefix = "EVETS3_"
+
+// EnvName returns a name of environment variable overriding a Config
+// field, e.g. EVETS3_TS3_PASSWORD for TS3Password.
+func EnvName(field string) string {
+	r := []rune(field)
+	var b strings.Builder
+	b.WriteString(EnvPrefix)
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) && wordStart(r, i) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToUpper(c))
+	}
+
+	return b.String()
+}
+
+// wordStart reports whether an upper case r[i] starts a new word.
+// Acronyms stay together, including a plural `s` like in IDs.
+func wordStart(r []rune, i int) bool {
+	prev := r[i-1]
+	if !unicode.IsUpper(prev) {
+		return true
+	}
+	if i+1 == len(r) || !unicode.IsLower(r[i+1]) {
+		return false
+	}
+	// r[i] is the last letter of an acronym followed by a plural `s`.
+	if r[i+1] == 's' && (i+2 == len(r) || !unicode.IsLower(r[i+2])) {
+		return false
+	}
+
+	return true
+}
+
+// ApplyEnv overrides viper's config values with environment variables
+// found by lookup. A variable with _FILE suffix names a file to read
+// the value from, which is meant for secrets.
+// Lists of strings are comma separated, lists of rules and sinks are json.
+func ApplyEnv(lookup func(string) (string, bool)) error {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := EnvName(f.Name)
+
+		v, ok := lookup(name)
+		if path, fileOK := lookup(name + "_FILE"); fileOK {
+			if ok {
+				return fmt.Errorf("both %s and %s_FILE are set", name, name)
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("%s_FILE: %s", name, err)
+			}
+			v, ok = strings.TrimRight(string(data), "\r\n"), true
+		}
+		if !ok {
+			continue
+		}
+
+		value, err := parseEnvValue(f.Type, v)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		viper.Set(f.Name, value)
+	}
+
+	return nil
+}
+
+// parseEnvValue converts v into a value of type t.
+func parseEnvValue(t reflect.Type, v string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return v, nil
+	case reflect.Int:
+		return strconv.Atoi(v)
+	case reflect.Bool:
+		return strconv.ParseBool(v)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			list := []string{}
+			for _, s := range strings.Split(v, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					list = append(list, s)
+				}
+			}
+			return list, nil
+		}
+	}
+
+	value := reflect.New(t)
+	err := json.Unmarshal([]byte(v), value.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("invalid json: %s", err)
+	}
+
+	return value.Elem().Interface(), nil
+}
@@ -0,0 +1,76 @@
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvName(t *testing.T) {
+	for field, name := range map[string]string{
+		"WebServerAddress":            "EVETS3_WEB_SERVER_ADDRESS",
+		"TS3Password":                 "EVETS3_TS3_PASSWORD",
+		"TS3RegisterQCleanupInterval": "EVETS3_TS3_REGISTER_Q_CLEANUP_INTERVAL",
+		"TS3GuestAdminGroupIDs":       "EVETS3_TS3_GUEST_ADMIN_GROUP_IDS",
+		"ESIBaseURL":                  "EVETS3_ESI_BASE_URL",
+		"PgConnString":                "EVETS3_PG_CONN_STRING",
+	} {
+		require.Equal(t, name, EnvName(field))
+	}
+
+	// Every field has its own variable.
+	seen := make(map[string]bool)
+	ct := reflect.TypeOf(Config{})
+	for i := 0; i < ct.NumField(); i++ {
+		name := EnvName(ct.Field(i).Name)
+		require.False(t, seen[name], name)
+		seen[name] = true
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	defer viper.Reset()
+	viper.AddConfigPath(".")
+	viper.SetConfigName("config_test")
+	err := viper.ReadInConfig()
+	require.Nil(t, err)
+
+	f, err := ioutil.TempFile("", "secret")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("s3cret\n")
+	f.Close()
+
+	env := map[string]string{
+		"EVETS3_TS3_PASSWORD_FILE":         f.Name(),
+		"EVETS3_TS3_REGISTER_TIMER":        "120",
+		"EVETS3_TS3_CREATE_CHANNELS":       "true",
+		"EVETS3_TS3_GUEST_ADMIN_GROUP_IDS": "6, 7",
+		"EVETS3_TS3_REMOVAL_RULES":         `[{"Action": "kick", "Message": "bye"}]`,
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	require.Nil(t, ApplyEnv(lookup))
+
+	c := NewViperConfig()
+	require.Equal(t, "s3cret", c.TS3Password)
+	require.Equal(t, 120, c.TS3RegisterTimer)
+	require.True(t, c.TS3CreateChannels)
+	require.Equal(t, []string{"6", "7"}, c.TS3GuestAdminGroupIDs)
+	require.Equal(t, []RemovalRule{{Action: "kick", Message: "bye"}},
+		c.TS3RemovalRules)
+	// Fields without variables keep values from the file.
+	require.Equal(t, "127.0.0.1:8083", c.WebServerAddress)
+
+	env["EVETS3_TS3_PASSWORD"] = "password"
+	require.NotNil(t, ApplyEnv(lookup))
+	delete(env, "EVETS3_TS3_PASSWORD")
+	env["EVETS3_TS3_SERVER_ID"] = "one"
+	require.NotNil(t, ApplyEnv(lookup))
+}
@@ -0,0 +1,167 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Hook starts and stops a service. Either func may be nil.
+// Stop must return once ctx is done even if work is still in progress.
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+}
+
+// Lifecycle starts services in order of registration and stops them
+// in reverse order.
+type Lifecycle struct {
+	lock    sync.Mutex
+	hooks   []Hook
+	started int
+}
+
+// NewLifecycle creates an empty Lifecycle.
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{}
+}
+
+// Append registers h. Hooks must be appended before Start.
+func (l *Lifecycle) Append(h Hook) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.hooks = append(l.hooks, h)
+}
+
+// Start runs Start funcs of hooks in order. If one of them fails or
+// panics, already started hooks are stopped and the error is returned.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for l.started < len(l.hooks) {
+		h := l.hooks[l.started]
+		if h.Start != nil {
+			log.Printf("system: starting %s\n", h.Name)
+			if err := callHook(ctx, h.Start); err != nil {
+				err = fmt.Errorf("%s failed to start: %s", h.Name, err)
+				log.Println("system:", err)
+				l.stop(ctx)
+				return err
+			}
+		}
+		l.started++
+	}
+
+	return nil
+}
+
+// Stop runs Stop funcs of started hooks in reverse order. Every hook is
+// stopped even if some fail, the first error is returned.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.stop(ctx)
+}
+
+func (l *Lifecycle) stop(ctx context.Context) error {
+	var first error
+	for ; l.started > 0; l.started-- {
+		h := l.hooks[l.started-1]
+		if h.Stop == nil {
+			continue
+		}
+		log.Printf("system: stopping %s\n", h.Name)
+		if err := callHook(ctx, h.Stop); err != nil {
+			log.Printf("system: %s failed to stop: %s\n", h.Name, err)
+			if first == nil {
+				first = fmt.Errorf("%s failed to stop: %s", h.Name, err)
+			}
+		}
+	}
+
+	return first
+}
+
+// callHook calls f turning a panic into an error.
+func callHook(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	return f(ctx)
+}
+
+// Tracker counts in-flight work so that shutdown can wait for it.
+// The zero value is ready to use.
+type Tracker struct {
+	lock     sync.Mutex
+	n        int
+	stopping bool
+	idle     chan struct{}
+}
+
+// Begin registers a unit of work. It returns false once Wait was called,
+// then the work must not be started.
+func (t *Tracker) Begin() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.stopping {
+		return false
+	}
+	t.n++
+
+	return true
+}
+
+// End marks a unit of work registered by Begin as done.
+func (t *Tracker) End() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.n--
+	if t.n == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// Wait stops accepting new work and waits until in-flight work is done
+// or ctx is done.
+func (t *Tracker) Wait(ctx context.Context) error {
+	t.lock.Lock()
+	t.stopping = true
+	t.lock.Unlock()
+
+	return t.Idle(ctx)
+}
+
+// Idle waits until in-flight work is done or ctx is done. Unlike Wait,
+// new work is still accepted.
+func (t *Tracker) Idle(ctx context.Context) error {
+	t.lock.Lock()
+	if t.n == 0 {
+		t.lock.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	n := t.n
+	t.lock.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d tasks still running: %s", n, ctx.Err())
+	}
+}
@@ -0,0 +1,83 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycle(t *testing.T) {
+	var calls []string
+	hook := func(name string, startErr error) Hook {
+		return Hook{
+			Name: name,
+			Start: func(context.Context) error {
+				calls = append(calls, "start "+name)
+				return startErr
+			},
+			Stop: func(context.Context) error {
+				calls = append(calls, "stop "+name)
+				return nil
+			},
+		}
+	}
+
+	l := NewLifecycle()
+	l.Append(hook("db", nil))
+	l.Append(hook("ts3", nil))
+	l.Append(Hook{Name: "noop"})
+	require.Nil(t, l.Start(context.Background()))
+	require.Nil(t, l.Stop(context.Background()))
+	require.Equal(t, []string{"start db", "start ts3", "stop ts3", "stop db"},
+		calls)
+
+	// A failed start stops hooks started before.
+	calls = nil
+	l = NewLifecycle()
+	l.Append(hook("db", nil))
+	l.Append(hook("ts3", errors.New("refused")))
+	l.Append(hook("http", nil))
+	l.Append(Hook{Name: "panic", Start: func(context.Context) error {
+		panic("must not start")
+	}})
+	err := l.Start(context.Background())
+	require.EqualError(t, err, "ts3 failed to start: refused")
+	require.Equal(t, []string{"start db", "start ts3", "stop db"}, calls)
+
+	// Panics are errors.
+	l = NewLifecycle()
+	l.Append(Hook{Name: "panic", Start: func(context.Context) error {
+		panic("boom")
+	}})
+	require.EqualError(t, l.Start(context.Background()),
+		"panic failed to start: boom")
+}
+
+func TestTracker(t *testing.T) {
+	var tr Tracker
+	require.Nil(t, tr.Wait(context.Background()))
+	require.False(t, tr.Begin())
+
+	var busy Tracker
+	require.True(t, busy.Begin())
+	idleCtx, idleCancel := context.WithTimeout(context.Background(),
+		10*time.Millisecond)
+	defer idleCancel()
+	require.NotNil(t, busy.Idle(idleCtx))
+	// Idle doesn't stop accepting work.
+	require.True(t, busy.Begin())
+	busy.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.NotNil(t, busy.Wait(ctx))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		busy.End()
+	}()
+	require.Nil(t, busy.Wait(context.Background()))
+}
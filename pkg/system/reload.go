@@ -0,0 +1,119 @@
+package system
+
+import (
+	"log"
+	"os"
+	"reflect"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// restartFields lists Config fields which are only read when services
+// start, so changing them needs a restart.
+var restartFields = map[string]bool{
+	"WebServerAddress":            true,
+	"TS3Address":                  true,
+	"TS3User":                     true,
+	"TS3Password":                 true,
+	"TS3ServerID":                 true,
+	"TS3Whitelisted":              true,
+	"TS3FloodCommands":            true,
+	"TS3FloodTime":                true,
+	"TS3FloodRetries":             true,
+	"TS3CommandTimeout":           true,
+	"TS3KeepAliveInterval":        true,
+	"TS3RegisterQCleanupInterval": true,
+	"TS3ValidateUsersInterval":    true,
+	"TS3IntervalJitter":           true,
+	"TS3GroupsCleanupInterval":    true,
+	"TS3AuditGroupsInterval":      true,
+	"TS3OnlineClientsInterval":    true,
+	"TS3GrantsSyncInterval":       true,
+	"NotifyQueueSize":             true,
+	"UsersValidator":              true,
+	"ESIBaseURL":                  true,
+	"ESIAffiliationInterval":      true,
+	"PgConnString":                true,
+	"LeaderElection":              true,
+}
+
+// ConfigReload lists changed Config fields. Applied fields are used right
+// away, Restart fields keep old values until the service is restarted.
+type ConfigReload struct {
+	Applied []string
+	Restart []string
+}
+
+// ReloadConfig validates c and replaces the current Config with it.
+// Fields listed in restartFields keep their current values.
+func (s *System) ReloadConfig(c *Config) (*ConfigReload, error) {
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	r := ConfigReload{Applied: []string{}, Restart: []string{}}
+	old := reflect.ValueOf(s.Config()).Elem()
+	cur := reflect.ValueOf(c).Elem()
+	for i := 0; i < cur.NumField(); i++ {
+		name := cur.Type().Field(i).Name
+		if reflect.DeepEqual(old.Field(i).Interface(), cur.Field(i).Interface()) {
+			continue
+		}
+		if restartFields[name] {
+			r.Restart = append(r.Restart, name)
+			cur.Field(i).Set(old.Field(i))
+			continue
+		}
+		r.Applied = append(r.Applied, name)
+	}
+	s.config.Store(c)
+
+	return &r, nil
+}
+
+// ReloadConfigFile rereads the config file, if one is used, and environment
+// variables and applies them with ReloadConfig.
+func (s *System) ReloadConfigFile() (*ConfigReload, error) {
+	s.reloadLock.Lock()
+	var err error
+	if viper.ConfigFileUsed() != "" {
+		err = viper.ReadInConfig()
+	}
+	if err == nil {
+		err = ApplyEnv(os.LookupEnv)
+	}
+	c := &Config{}
+	if err == nil {
+		err = viper.Unmarshal(c)
+	}
+	s.reloadLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ReloadConfig(c)
+}
+
+// LogConfigReload logs the outcome of a config reload triggered by source.
+func LogConfigReload(source string, r *ConfigReload, err error) {
+	if err != nil {
+		log.Printf("system: config reload on %s failed: %s\n", source, err)
+		return
+	}
+	log.Printf("system: config reloaded on %s, applied %v, "+
+		"restart required for %v\n", source, r.Applied, r.Restart)
+}
+
+// WatchConfig reloads config when the config file changes.
+func (s *System) WatchConfig() {
+	viper.OnConfigChange(func(fsnotify.Event) {
+		r, err := s.ReloadConfigFile()
+		LogConfigReload("file change", r, err)
+	})
+	viper.WatchConfig()
+}
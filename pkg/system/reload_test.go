@@ -0,0 +1,65 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadConfig(t *testing.T) {
+	viper.AddConfigPath(".")
+	viper.SetConfigName("config_test")
+	err := viper.ReadInConfig()
+	require.Nil(t, err)
+
+	old := NewViperConfig()
+	old.TS3Password = "password"
+	sys := NewWithConfig(old)
+
+	c := *old
+	c.TS3RegisterTimer = 120
+	c.TS3ReferenceGroupID = "8"
+	c.TS3Address = "10.0.0.1:10011"
+	r, err := sys.ReloadConfig(&c)
+	require.Nil(t, err)
+	require.Equal(t, []string{"TS3ReferenceGroupID", "TS3RegisterTimer"},
+		r.Applied)
+	require.Equal(t, []string{"TS3Address"}, r.Restart)
+	require.Equal(t, 120, sys.Config().TS3RegisterTimer)
+	require.Equal(t, "127.0.0.1:10011", sys.Config().TS3Address)
+
+	// Invalid config is not applied.
+	bad := *sys.Config()
+	bad.TS3RegisterTimer = 0
+	_, err = sys.ReloadConfig(&bad)
+	require.NotNil(t, err)
+	require.Equal(t, 120, sys.Config().TS3RegisterTimer)
+}
+
+func TestReloadConfigConcurrentReads(t *testing.T) {
+	viper.AddConfigPath(".")
+	viper.SetConfigName("config_test")
+	err := viper.ReadInConfig()
+	require.Nil(t, err)
+
+	old := NewViperConfig()
+	old.TS3Password = "password"
+	sys := NewWithConfig(old)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c := sys.Config()
+			require.True(t, c.TS3RegisterTimer > 0)
+		}
+	}()
+	for i := 1; i <= 100; i++ {
+		c := *sys.Config()
+		c.TS3RegisterTimer = i
+		_, err := sys.ReloadConfig(&c)
+		require.Nil(t, err)
+	}
+	<-done
+	require.Equal(t, 100, sys.Config().TS3RegisterTimer)
+}
@@ -4,10 +4,13 @@ import (
 	"log"
 	"os"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 
 	"github.com/spf13/viper"
 
 	"github.com/prusya/eve-ts3-service/pkg/http"
+	"github.com/prusya/eve-ts3-service/pkg/notify"
 	"github.com/prusya/eve-ts3-service/pkg/ts3"
 )
 
@@ -15,13 +18,28 @@ import (
 type System struct {
 	TS3     ts3.Service
 	HTTP    http.Service
-	Config  *Config
+	Notify  notify.Service
 	SigChan chan os.Signal
+
+	// config holds the current *Config, which is replaced as a whole
+	// on reload.
+	config atomic.Value
+	// reloadLock serializes config reloads.
+	reloadLock sync.Mutex
+}
+
+// Config returns the current config. A reload replaces it with a new one,
+// so the returned Config is a consistent snapshot which must not be
+// modified. Long running jobs should take a snapshot once.
+func (s *System) Config() *Config {
+	c, _ := s.config.Load().(*Config)
+	return c
 }
 
 // Config contains all configurable options.
 type Config struct {
 	WebServerAddress string
+	AdminSecret      string
 
 	TS3Address          string
 	TS3User             string
@@ -30,19 +48,121 @@ type Config struct {
 	TS3Whitelisted      string
 	TS3ReferenceGroupID string
 	TS3RegisterTimer    int
+	TS3FloodCommands    int
+	TS3FloodTime        int
+	TS3FloodRetries     int
+
+	TS3KeepAliveInterval        int
+	TS3RegisterQCleanupInterval int
+	TS3ValidateUsersInterval    int
+	TS3IntervalJitter           int
+	TS3GroupsCleanupInterval    int
+	TS3EmptyGroupTTL            int
+
+	TS3ChannelRules          []ChannelRule
+	TS3DefaultChannelGroupID string
+	TS3CreateChannels        bool
+
+	TS3RemovalRules []RemovalRule
+
+	TS3ProtectedGroupIDs      []string
+	TS3ProtectedGroupPatterns []string
 
+	TS3AuditMode           string
+	TS3AuditGroupsInterval int
+	TS3CommandTimeout      int
+
+	TS3OnlineClientsInterval int
+	TS3GrantsSyncInterval    int
+
+	TS3GuestGroupID       string
+	TS3GuestDuration      int
+	TS3GuestAdminGroupIDs []string
+
+	NotifySinks     []NotifySink
+	NotifyQueueSize int
+	NotifyRetries   int
+
+	UsersValidator          string
 	UsersValidationEndpoint string
+	UserStatusSecret        string
+	AllowlistFile           string
+	ESIBaseURL              string
+	ESIAffiliationInterval  int
 
 	PgConnString string
+
+	LeaderElection bool
+
+	ShutdownTimeout int
+}
+
+// ChannelRule assigns a channel group in a channel to users of matching
+// eve corporation and alliance. Zero id matches any. Tickers can change,
+// so they are only matched when the id is zero, for older configs.
+// A rule without ids and tickers matches every user.
+// ChannelName and SubChannels may contain `{corp}` and `{alli}` placeholders
+// which are replaced with user's tickers.
+type ChannelRule struct {
+	EveCorpID int32
+	EveAlliID int32
+
+	EveCorpTicker string
+	EveAlliTicker string
+
+	// ChannelID is used as is if set, otherwise a channel is looked up
+	// by ChannelName under ParentChannelID.
+	ChannelID       string
+	ChannelName     string
+	ParentChannelID string
+	// SubChannels are created inside a channel created by the service.
+	SubChannels []string
+
+	ChannelGroupID string
+}
+
+// RemovalRule defines what happens to invalid users of matching eve
+// corporation and alliance. Ids and tickers are matched like in ChannelRule.
+type RemovalRule struct {
+	EveCorpID int32
+	EveAlliID int32
+
+	EveCorpTicker string
+	EveAlliTicker string
+
+	// Action is one of `groups`, `kick`, `move` or `ban`.
+	// Users are always removed from server and channel groups first.
+	Action string
+	// Message is shown to kicked users and used as a ban reason.
+	Message string
+	// ChannelID is a quarantine channel for `move` action.
+	ChannelID string
+	// BanDuration is a ban duration in seconds for `ban` action.
+	// 0 means permanent ban.
+	BanDuration int
+}
+
+// NotifySink defines where to deliver notifications about events.
+type NotifySink struct {
+	// Type is one of `webhook`, `discord` or `slack`.
+	Type string
+	URL  string
+	// Events lists event types to deliver. Empty list means all events.
+	Events []string
 }
 
 // New creates a new System.
 func New(sigChan chan os.Signal) *System {
-	config := NewViperConfig()
-	s := System{
-		SigChan: sigChan,
-		Config:  config,
-	}
+	s := NewWithConfig(NewViperConfig())
+	s.SigChan = sigChan
+
+	return s
+}
+
+// NewWithConfig creates a new System with c as the current config.
+func NewWithConfig(c *Config) *System {
+	var s System
+	s.config.Store(c)
 
 	return &s
 }
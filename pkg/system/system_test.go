@@ -46,7 +46,7 @@ func TestNew(t *testing.T) {
 
 	sigChan := make(chan os.Signal, 1)
 	sys := New(sigChan)
-	require.Equal(t, "127.0.0.1:8083", sys.Config.WebServerAddress)
-	require.Equal(t, 300, sys.Config.TS3RegisterTimer)
+	require.Equal(t, "127.0.0.1:8083", sys.Config().WebServerAddress)
+	require.Equal(t, 300, sys.Config().TS3RegisterTimer)
 	require.Equal(t, sigChan, sys.SigChan)
 }
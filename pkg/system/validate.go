@@ -0,0 +1,212 @@
+package system
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ConfigError lists all problems found in a Config.
+type ConfigError []string
+
+func (e ConfigError) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate checks that c can be used to run the service.
+// It returns a ConfigError describing every problem found.
+func (c *Config) Validate() error {
+	var e ConfigError
+	add := func(format string, args ...interface{}) {
+		e = append(e, fmt.Sprintf(format, args...))
+	}
+
+	checkAddress := func(field, v string) {
+		if v == "" {
+			add("%s is required", field)
+			return
+		}
+		if _, _, err := net.SplitHostPort(v); err != nil {
+			add("%s %q must be host:port: %s", field, v, err)
+		}
+	}
+	checkURL := func(field, v string) {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" {
+			add("%s %q must be an http(s) url", field, v)
+		}
+	}
+
+	checkAddress("WebServerAddress", c.WebServerAddress)
+	checkAddress("TS3Address", c.TS3Address)
+	if c.TS3User == "" {
+		add("TS3User is required")
+	}
+	if c.TS3Password == "" {
+		add("TS3Password is required")
+	}
+	if c.TS3ServerID <= 0 {
+		add("TS3ServerID must be positive, got %d", c.TS3ServerID)
+	}
+	if c.TS3Whitelisted != "" && c.TS3Whitelisted != "true" &&
+		c.TS3Whitelisted != "false" {
+		add("TS3Whitelisted must be \"true\" or \"false\", got %q",
+			c.TS3Whitelisted)
+	}
+	if c.TS3ReferenceGroupID == "" {
+		add("TS3ReferenceGroupID is required")
+	}
+	if c.TS3RegisterTimer <= 0 {
+		add("TS3RegisterTimer must be positive, got %d", c.TS3RegisterTimer)
+	}
+
+	for _, f := range []struct {
+		name  string
+		value int
+	}{
+		{"TS3FloodCommands", c.TS3FloodCommands},
+		{"TS3FloodTime", c.TS3FloodTime},
+		{"TS3FloodRetries", c.TS3FloodRetries},
+		{"TS3KeepAliveInterval", c.TS3KeepAliveInterval},
+		{"TS3RegisterQCleanupInterval", c.TS3RegisterQCleanupInterval},
+		{"TS3ValidateUsersInterval", c.TS3ValidateUsersInterval},
+		{"TS3IntervalJitter", c.TS3IntervalJitter},
+		{"TS3GroupsCleanupInterval", c.TS3GroupsCleanupInterval},
+		{"TS3EmptyGroupTTL", c.TS3EmptyGroupTTL},
+		{"TS3AuditGroupsInterval", c.TS3AuditGroupsInterval},
+		{"TS3CommandTimeout", c.TS3CommandTimeout},
+		{"TS3OnlineClientsInterval", c.TS3OnlineClientsInterval},
+		{"TS3GrantsSyncInterval", c.TS3GrantsSyncInterval},
+		{"TS3GuestDuration", c.TS3GuestDuration},
+		{"NotifyQueueSize", c.NotifyQueueSize},
+		{"NotifyRetries", c.NotifyRetries},
+		{"ESIAffiliationInterval", c.ESIAffiliationInterval},
+		{"ShutdownTimeout", c.ShutdownTimeout},
+	} {
+		if f.value < 0 {
+			add("%s must not be negative, got %d", f.name, f.value)
+		}
+	}
+
+	for i, r := range c.TS3ChannelRules {
+		if r.ChannelID == "" && r.ChannelName == "" {
+			add("TS3ChannelRules[%d] needs ChannelID or ChannelName", i)
+		}
+		if r.ChannelGroupID == "" {
+			add("TS3ChannelRules[%d].ChannelGroupID is required", i)
+		}
+	}
+
+	for i, r := range c.TS3RemovalRules {
+		switch r.Action {
+		case "", "groups", "kick", "ban":
+		case "move":
+			if r.ChannelID == "" {
+				add("TS3RemovalRules[%d].ChannelID is required for "+
+					"\"move\" action", i)
+			}
+		default:
+			add("TS3RemovalRules[%d].Action must be one of groups, kick, "+
+				"move, ban, got %q", i, r.Action)
+		}
+		if r.BanDuration < 0 {
+			add("TS3RemovalRules[%d].BanDuration must not be negative, "+
+				"got %d", i, r.BanDuration)
+		}
+	}
+
+	for i, p := range c.TS3ProtectedGroupPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			add("TS3ProtectedGroupPatterns[%d] %q is not a valid regexp: %s",
+				i, p, err)
+		}
+	}
+
+	switch c.TS3AuditMode {
+	case "", "report", "flag", "strip":
+	default:
+		add("TS3AuditMode must be one of report, flag, strip or empty, "+
+			"got %q", c.TS3AuditMode)
+	}
+
+	if c.TS3GuestGroupID != "" && c.TS3GuestDuration == 0 {
+		add("TS3GuestDuration must be positive when TS3GuestGroupID is set")
+	}
+	if c.TS3GuestGroupID != "" && c.TS3GuestGroupID == c.TS3ReferenceGroupID {
+		add("TS3GuestGroupID must not be the reference group")
+	}
+	for _, id := range c.TS3ProtectedGroupIDs {
+		if c.TS3GuestGroupID != "" && c.TS3GuestGroupID == id {
+			add("TS3GuestGroupID must not be a protected group")
+		}
+	}
+
+	for i, s := range c.NotifySinks {
+		switch s.Type {
+		case "webhook", "discord", "slack":
+		default:
+			add("NotifySinks[%d].Type must be one of webhook, discord, "+
+				"slack, got %q", i, s.Type)
+		}
+		checkURL(fmt.Sprintf("NotifySinks[%d].URL", i), s.URL)
+	}
+
+	switch c.UsersValidator {
+	case "", "http":
+		checkURL("UsersValidationEndpoint", c.UsersValidationEndpoint)
+	case "allowlist", "esi":
+		if c.AllowlistFile == "" {
+			add("AllowlistFile is required for %q users validator",
+				c.UsersValidator)
+		}
+	default:
+		add("UsersValidator must be one of http, allowlist, esi, got %q",
+			c.UsersValidator)
+	}
+	if c.ESIBaseURL != "" {
+		checkURL("ESIBaseURL", c.ESIBaseURL)
+	}
+
+	if err := checkPgConnString(c.PgConnString); err != nil {
+		add("PgConnString is invalid: %s", err)
+	}
+
+	if len(e) > 0 {
+		return e
+	}
+
+	return nil
+}
+
+// checkPgConnString checks that s is a postgres url or a space separated
+// list of key=value pairs.
+func checkPgConnString(s string) error {
+	if s == "" {
+		return fmt.Errorf("it is required")
+	}
+
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+			return fmt.Errorf("url scheme must be postgres, got %q", u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("url has no host")
+		}
+		return nil
+	}
+
+	for _, kv := range strings.Fields(s) {
+		if !strings.Contains(kv, "=") {
+			return fmt.Errorf("%q is not a key=value pair", kv)
+		}
+	}
+
+	return nil
+}
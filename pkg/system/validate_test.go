@@ -0,0 +1,69 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	viper.AddConfigPath(".")
+	viper.SetConfigName("config_test")
+	err := viper.ReadInConfig()
+	require.Nil(t, err)
+
+	c := NewViperConfig()
+	err = c.Validate()
+	require.Equal(t, ConfigError{"TS3Password is required"}, err)
+
+	c.TS3Password = "password"
+	require.Nil(t, c.Validate())
+
+	c.TS3RegisterTimer = 0
+	c.TS3Address = "127.0.0.1"
+	c.TS3RemovalRules = []RemovalRule{{Action: "move"}, {Action: "mute"}}
+	c.TS3ProtectedGroupPatterns = []string{"("}
+	c.UsersValidator = "http"
+	c.UsersValidationEndpoint = "127.0.0.1:8081/api"
+	c.PgConnString = "mysql://user@host/db"
+	err = c.Validate()
+	require.NotNil(t, err)
+	errs := err.(ConfigError)
+	require.Len(t, errs, 7)
+	require.Contains(t, errs[0], "TS3Address \"127.0.0.1\" must be host:port")
+	require.Equal(t, "TS3RegisterTimer must be positive, got 0", errs[1])
+	require.Equal(t, "TS3RemovalRules[0].ChannelID is required for "+
+		"\"move\" action", errs[2])
+	require.Contains(t, errs[3], "TS3RemovalRules[1].Action")
+	require.Contains(t, errs[4], "TS3ProtectedGroupPatterns[0]")
+	require.Contains(t, errs[5], "UsersValidationEndpoint")
+	require.Equal(t, "PgConnString is invalid: url scheme must be "+
+		"postgres, got \"mysql\"", errs[6])
+}
+
+func TestValidateGuestGroup(t *testing.T) {
+	viper.AddConfigPath(".")
+	viper.SetConfigName("config_test")
+	err := viper.ReadInConfig()
+	require.Nil(t, err)
+
+	c := NewViperConfig()
+	c.TS3Password = "password"
+	c.TS3GuestGroupID = "6"
+	require.Equal(t, ConfigError{"TS3GuestGroupID must not be a protected group"},
+		c.Validate())
+	c.TS3GuestGroupID = "7"
+	require.Equal(t, ConfigError{"TS3GuestGroupID must not be the reference group"},
+		c.Validate())
+	c.TS3GuestGroupID = "12"
+	require.Nil(t, c.Validate())
+}
+
+func TestCheckPgConnString(t *testing.T) {
+	require.Nil(t, checkPgConnString("postgres://u:p@localhost/db"))
+	require.Nil(t, checkPgConnString("host=localhost dbname=db"))
+	require.NotNil(t, checkPgConnString(""))
+	require.NotNil(t, checkPgConnString("postgres:///db"))
+	require.NotNil(t, checkPgConnString("localhost"))
+}
@@ -0,0 +1,97 @@
+package allowlistts3validator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+const (
+	validatorName = "allowlistts3validator"
+)
+
+// Allowlist lists eve corporations and alliances whose members have access
+// to ts3 service.
+type Allowlist struct {
+	CorpIDs []int32
+	AlliIDs []int32
+}
+
+// Load reads an Allowlist from a json file.
+func Load(path string) (*Allowlist, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var a Allowlist
+	err = json.Unmarshal(data, &a)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// Allows checks whether members of provided corp and alli have access.
+func (a *Allowlist) Allows(corpID, alliID int32) bool {
+	for _, id := range a.CorpIDs {
+		if id == corpID {
+			return true
+		}
+	}
+	if alliID == 0 {
+		return false
+	}
+	for _, id := range a.AlliIDs {
+		if id == alliID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validator implements ts3.Validator interface by checking users' stored
+// corp and alli against AllowlistFile.
+type Validator struct {
+	system *system.System
+}
+
+// New creates a new Validator.
+func New(system *system.System) *Validator {
+	v := Validator{
+		system: system,
+	}
+
+	return &v
+}
+
+// Validate checks users against the allowlist. The file is read on every
+// call, so changes apply without restart.
+// Users with unknown corp are skipped, they are left as is.
+func (v *Validator) Validate(users []*ts3.User) []ts3.UserStatus {
+	file := v.system.Config().AllowlistFile
+	a, err := Load(file)
+	system.HandleError(err, validatorName+".Validate",
+		"file="+file)
+
+	var statuses []ts3.UserStatus
+	for _, u := range users {
+		if u.EveCorpID == 0 {
+			continue
+		}
+		statuses = append(statuses, ts3.UserStatus{
+			EveCharID:     u.EveCharID,
+			EveCorpID:     u.EveCorpID,
+			EveCorpTicker: u.EveCorpTicker,
+			EveAlliID:     u.EveAlliID,
+			EveAlliTicker: u.EveAlliTicker,
+			Valid:         a.Allows(u.EveCorpID, u.EveAlliID),
+		})
+	}
+
+	return statuses
+}
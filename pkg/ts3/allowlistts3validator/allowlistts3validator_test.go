@@ -0,0 +1,57 @@
+package allowlistts3validator
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestAllows(t *testing.T) {
+	a := &Allowlist{
+		CorpIDs: []int32{1},
+		AlliIDs: []int32{10},
+	}
+	require.True(t, a.Allows(1, 0))
+	require.True(t, a.Allows(2, 10))
+	require.False(t, a.Allows(2, 11))
+	require.False(t, a.Allows(2, 0))
+}
+
+func TestValidate(t *testing.T) {
+	f, err := ioutil.TempFile("", "allowlist")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString(`{"CorpIDs": [1], "AlliIDs": [10]}`)
+	f.Close()
+
+	sys := system.NewWithConfig(&system.Config{
+		AllowlistFile: f.Name(),
+	})
+	v := New(sys)
+	statuses := v.Validate([]*ts3.User{
+		{EveCharID: 1, EveCorpID: 1, EveCorpTicker: "A"},
+		{EveCharID: 2, EveCorpID: 2, EveAlliID: 10},
+		{EveCharID: 3, EveCorpID: 3},
+		{EveCharID: 4},
+	})
+	require.Len(t, statuses, 3)
+	require.True(t, statuses[0].Valid)
+	require.Equal(t, "A", statuses[0].EveCorpTicker)
+	require.True(t, statuses[1].Valid)
+	require.False(t, statuses[2].Valid)
+}
+
+func TestValidateMissingFile(t *testing.T) {
+	sys := system.NewWithConfig(&system.Config{
+		AllowlistFile: "does not exist",
+	})
+	v := New(sys)
+	require.Panics(t, func() {
+		v.Validate([]*ts3.User{{EveCharID: 1}})
+	})
+}
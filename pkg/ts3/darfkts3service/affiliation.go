@@ -0,0 +1,64 @@
+package darfkts3service
+
+import (
+	"log"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+// checkAffiliations looks up active users' current corp and alli in ESI
+// and applies changes without waiting for the validation server.
+// Users whose ids are not stored yet get them filled in.
+func (s *Service) checkAffiliations() {
+	defer recoverPanic()
+
+	users := make(map[int32][]*ts3.User)
+	var ids []int32
+	for _, u := range s.store.Users() {
+		if !u.Active || u.Guest {
+			continue
+		}
+		if _, ok := users[u.EveCharID]; !ok {
+			ids = append(ids, u.EveCharID)
+		}
+		users[u.EveCharID] = append(users[u.EveCharID], u)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	affiliations, err := s.esi.Affiliation(ids)
+	system.HandleError(err, serviceName+".checkAffiliations", len(ids))
+
+	for _, af := range affiliations {
+		changed := false
+		for _, u := range users[af.CharacterID] {
+			if u.EveCorpID != af.CorporationID ||
+				u.EveAlliID != af.AllianceID {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		corp, alli, err := s.esi.Resolve(af)
+		if err != nil {
+			log.Printf("%s: checkAffiliations: %s\n", serviceName, err)
+			continue
+		}
+		// Access is decided by the validator, here we only follow
+		// corp and alli changes.
+		s.ApplyUserStatus(ts3.UserStatus{
+			EveCharID:     af.CharacterID,
+			EveCorpID:     af.CorporationID,
+			EveCorpName:   corp.Name,
+			EveCorpTicker: corp.Ticker,
+			EveAlliID:     af.AllianceID,
+			EveAlliName:   alli.Name,
+			EveAlliTicker: alli.Ticker,
+			Valid:         true,
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package darfkts3service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/esi"
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestCheckAffiliations(t *testing.T) {
+	var lookups []string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			lookups = append(lookups, r.URL.Path)
+			switch r.URL.Path {
+			case "/characters/affiliation/":
+				fmt.Fprint(w, `[
+					{"character_id": 1, "corporation_id": 101, "alliance_id": 200},
+					{"character_id": 2, "corporation_id": 100, "alliance_id": 200}
+				]`)
+			case "/corporations/101/":
+				fmt.Fprint(w, `{"ticker":"NEW"}`)
+			case "/alliances/200/":
+				fmt.Fprint(w, `{"ticker":"ALLI"}`)
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+	defer server.Close()
+
+	store := &fakeStore{
+		users: []*ts3.User{
+			{EveCharID: 1, EveCorpTicker: "OLD", EveAlliTicker: "ALLI",
+				TS3UID: "a", TS3CLDBID: "1", Active: true},
+			{EveCharID: 2, EveCorpID: 100, EveCorpTicker: "OLD", EveAlliID: 200,
+				EveAlliTicker: "ALLI", TS3UID: "b", TS3CLDBID: "2", Active: true},
+		},
+	}
+	var added []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "servergrouplist":
+				return client.ParseResponse(`sgid=11 name=ALLI\sNEW type=1`), nil
+			case "servergroupaddclient":
+				added = append(added, cmd.Params["sgid"][0]+":"+
+					cmd.Params["cldbid"][0])
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(&system.Config{}, store, e)
+	s.esi = esi.New(server.URL)
+
+	s.checkAffiliations()
+	require.Equal(t, []string{"11:1"}, added)
+	require.Equal(t, "NEW", store.users[0].EveCorpTicker)
+	require.Equal(t, int32(101), store.users[0].EveCorpID)
+	require.Equal(t, int32(200), store.users[0].EveAlliID)
+	require.Equal(t, "OLD", store.users[1].EveCorpTicker)
+	// Corp and alli are looked up only for changed characters.
+	require.Equal(t, []string{"/characters/affiliation/", "/corporations/101/",
+		"/alliances/200/"}, lookups)
+}
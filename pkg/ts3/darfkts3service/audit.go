@@ -0,0 +1,72 @@
+package darfkts3service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+const (
+	auditReport = "report"
+	auditFlag   = "flag"
+	auditStrip  = "strip"
+
+	// auditUnregistered is a kind of audit events about members of managed
+	// groups without an active user record.
+	auditUnregistered = "unregistered member"
+
+	defaultAuditGroupsInterval = time.Hour
+)
+
+// auditGroups looks for members of managed server groups who don't have
+// an active user record and handles them according to TS3AuditMode.
+func (s *Service) auditGroups() {
+	defer recoverPanic()
+
+	mode := s.system.Config().TS3AuditMode
+	if mode == "" {
+		return
+	}
+
+	active := make(map[string]bool)
+	for _, u := range s.store.Users() {
+		if u.Active {
+			active[u.TS3CLDBID] = true
+		}
+	}
+
+	for _, g := range s.store.Groups() {
+		members, _ := s.serverGroupClientList(g.SGID)
+		for _, m := range members {
+			cldbid := m["cldbid"]
+			if active[cldbid] {
+				continue
+			}
+
+			details := fmt.Sprintf("%q cldbid=%s is in group %q sgid=%s "+
+				"without an active user record", m["client_nickname"], cldbid,
+				g.Name, g.SGID)
+			log.Printf("%s: audit: %s\n", serviceName, details)
+			if mode == auditReport {
+				continue
+			}
+
+			if !s.store.PendingAuditEventExists(auditUnregistered, cldbid,
+				g.SGID) {
+				s.store.CreateAuditEvent(&ts3.AuditEvent{
+					At:        time.Now().Unix(),
+					Kind:      auditUnregistered,
+					Details:   details,
+					TS3UID:    m["client_unique_identifier"],
+					TS3CLDBID: cldbid,
+					SGID:      g.SGID,
+				})
+			}
+			if mode == auditStrip {
+				s.serverGroupDelClient(g.SGID, cldbid)
+			}
+		}
+	}
+}
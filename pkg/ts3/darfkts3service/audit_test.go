@@ -0,0 +1,64 @@
+package darfkts3service
+
+import (
+	"testing"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestAuditGroups(t *testing.T) {
+	newStore := func() *fakeStore {
+		return &fakeStore{
+			users: []*ts3.User{
+				{TS3CLDBID: "1", Active: true},
+				{TS3CLDBID: "2", Active: false},
+			},
+			groups: []*ts3.Group{{SGID: "10", Name: "ALLI CORP"}},
+		}
+	}
+	var stripped []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "servergroupclientlist":
+				return client.ParseResponse(
+					"cldbid=1 client_nickname=a|cldbid=2 client_nickname=b|cldbid=3 client_nickname=c"), nil
+			case "servergroupdelclient":
+				stripped = append(stripped, cmd.Params["cldbid"][0])
+			}
+			return client.Response{}, nil
+		},
+	}
+
+	t.Run("TestReport", func(t *testing.T) {
+		store := newStore()
+		s := newTestService(&system.Config{TS3AuditMode: auditReport}, store, e)
+		s.auditGroups()
+		require.Empty(t, store.events)
+		require.Empty(t, stripped)
+	})
+
+	t.Run("TestFlag", func(t *testing.T) {
+		store := newStore()
+		s := newTestService(&system.Config{TS3AuditMode: auditFlag}, store, e)
+		s.auditGroups()
+		// Events must not be duplicated.
+		s.auditGroups()
+		require.Len(t, store.events, 2)
+		require.Equal(t, "2", store.events[0].TS3CLDBID)
+		require.Equal(t, "3", store.events[1].TS3CLDBID)
+		require.Empty(t, stripped)
+	})
+
+	t.Run("TestStrip", func(t *testing.T) {
+		store := newStore()
+		s := newTestService(&system.Config{TS3AuditMode: auditStrip}, store, e)
+		s.auditGroups()
+		require.Len(t, store.events, 2)
+		require.Equal(t, []string{"2", "3"}, stripped)
+	})
+}
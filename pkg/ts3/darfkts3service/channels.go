@@ -0,0 +1,160 @@
+package darfkts3service
+
+import (
+	"errors"
+	"strings"
+
+	client "github.com/darfk/ts3"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+// channelRules returns channel rules matching user's corp and alli.
+// A rule without ids and tickers matches every user.
+func (s *Service) channelRules(u *ts3.User) []system.ChannelRule {
+	var rules []system.ChannelRule
+	for _, r := range s.system.Config().TS3ChannelRules {
+		if matchAffiliation(u, r.EveCorpID, r.EveAlliID, r.EveCorpTicker,
+			r.EveAlliTicker) {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules
+}
+
+// assignChannelGroups sets channel groups to user according to channel rules.
+// Missing channels are created if TS3CreateChannels is enabled.
+func (s *Service) assignChannelGroups(u *ts3.User) {
+	for _, r := range s.channelRules(u) {
+		cid, found := s.ruleChannel(r, u, s.system.Config().TS3CreateChannels)
+		if !found {
+			continue
+		}
+		s.setClientChannelGroup(r.ChannelGroupID, cid, u.TS3CLDBID)
+	}
+}
+
+// revokeChannelGroups sets the default channel group to user in every
+// channel from channel rules matching user.
+func (s *Service) revokeChannelGroups(u *ts3.User) {
+	rules := s.channelRules(u)
+	if len(rules) == 0 {
+		return
+	}
+
+	cgid := s.defaultChannelGroupID()
+	for _, r := range rules {
+		cid, found := s.ruleChannel(r, u, false)
+		if !found {
+			continue
+		}
+		s.setClientChannelGroup(cgid, cid, u.TS3CLDBID)
+	}
+}
+
+// ruleChannel returns cid of a channel the rule points to for user
+// and whether it exists. The channel with its sub channels is created
+// if it doesn't exist and create is true.
+func (s *Service) ruleChannel(r system.ChannelRule, u *ts3.User,
+	create bool) (string, bool) {
+	if r.ChannelID != "" {
+		return r.ChannelID, true
+	}
+
+	name := expandChannelName(r.ChannelName, u)
+	cid, found := s.channelByName(name, r.ParentChannelID)
+	if found || !create {
+		return cid, found
+	}
+
+	cid = s.channelCreate(name, r.ParentChannelID)
+	for _, sub := range r.SubChannels {
+		s.channelCreate(expandChannelName(sub, u), cid)
+	}
+
+	return cid, true
+}
+
+// expandChannelName replaces `{corp}` and `{alli}` in name with user's tickers.
+func expandChannelName(name string, u *ts3.User) string {
+	return strings.NewReplacer("{corp}", u.EveCorpTicker,
+		"{alli}", u.EveAlliTicker).Replace(name)
+}
+
+// channelByName returns whether a channel exists and its cid.
+// Empty pid matches channels with any parent.
+func (s *Service) channelByName(name, pid string) (string, bool) {
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "channellist",
+	})
+	system.HandleError(err, serviceName+".channelByName", "name="+name)
+
+	for _, channel := range resp.Params {
+		if channel["channel_name"] != name {
+			continue
+		}
+		if pid != "" && channel["pid"] != pid {
+			continue
+		}
+		return channel["cid"], true
+	}
+
+	return "", false
+}
+
+// channelCreate creates a permanent channel and returns its cid.
+func (s *Service) channelCreate(name, pid string) string {
+	params := map[string][]string{
+		"channel_name":           []string{name},
+		"channel_flag_permanent": []string{"1"},
+	}
+	if pid != "" {
+		params["cpid"] = []string{pid}
+	}
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "channelcreate",
+		Params:  params,
+	})
+	system.HandleError(err, serviceName+".channelCreate", "name="+name,
+		"pid="+pid)
+
+	cid, ok := resp.Params[0]["cid"]
+	if !ok {
+		err := errors.New("missing cid in response")
+		system.HandleError(err, serviceName+".channelCreate", "name="+name,
+			resp.Params)
+	}
+
+	return cid
+}
+
+// setClientChannelGroup sets a channel group to user in a channel.
+func (s *Service) setClientChannelGroup(cgid, cid, cldbid string) {
+	_, err := s.scheduler.Exec(client.Command{
+		Command: "setclientchannelgroup",
+		Params: map[string][]string{
+			"cgid":   []string{cgid},
+			"cid":    []string{cid},
+			"cldbid": []string{cldbid},
+		},
+	})
+	system.HandleError(err, serviceName+".setClientChannelGroup",
+		"cgid="+cgid, "cid="+cid, "cldbid="+cldbid)
+}
+
+// defaultChannelGroupID returns configured TS3DefaultChannelGroupID or
+// the default channel group of the virtual server.
+func (s *Service) defaultChannelGroupID() string {
+	if cgid := s.system.Config().TS3DefaultChannelGroupID; cgid != "" {
+		return cgid
+	}
+
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "serverinfo",
+	})
+	system.HandleError(err, serviceName+".defaultChannelGroupID")
+
+	return resp.Params[0]["virtualserver_default_channel_group"]
+}
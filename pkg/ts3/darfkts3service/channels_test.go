@@ -0,0 +1,84 @@
+package darfkts3service
+
+import (
+	"testing"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestChannelRules(t *testing.T) {
+	config := &system.Config{
+		TS3ChannelRules: []system.ChannelRule{
+			{EveAlliTicker: "ALLI", ChannelID: "1"},
+			{EveCorpTicker: "CORP", EveAlliTicker: "ALLI", ChannelID: "2"},
+			{EveCorpTicker: "OTHER", ChannelID: "3"},
+			{ChannelID: "4"},
+			{EveCorpID: 100, EveAlliID: 200, ChannelID: "5"},
+			{EveCorpID: 101, ChannelID: "6"},
+			// Ids take precedence over tickers.
+			{EveCorpID: 101, EveCorpTicker: "CORP", ChannelID: "7"},
+		},
+	}
+	s := newTestService(config, &fakeStore{}, &fakeExecutor{})
+
+	rules := s.channelRules(&ts3.User{EveCorpID: 100, EveCorpTicker: "CORP",
+		EveAlliID: 200, EveAlliTicker: "ALLI"})
+	var cids []string
+	for _, r := range rules {
+		cids = append(cids, r.ChannelID)
+	}
+	// A rule without ids and tickers matches every user.
+	require.Equal(t, []string{"1", "2", "4", "5"}, cids)
+}
+
+func TestAssignChannelGroups(t *testing.T) {
+	config := &system.Config{
+		TS3CreateChannels: true,
+		TS3ChannelRules: []system.ChannelRule{
+			{
+				EveAlliTicker:   "ALLI",
+				ChannelName:     "{alli} {corp}",
+				ParentChannelID: "1",
+				SubChannels:     []string{"{corp} Ops"},
+				ChannelGroupID:  "9",
+			},
+		},
+	}
+	var created []string
+	var cgid, cid, cldbid string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "channellist":
+				return client.ParseResponse(
+					`cid=1 pid=0 channel_name=Lobby|cid=2 pid=0 channel_name=ALLI\sCORP`), nil
+			case "channelcreate":
+				created = append(created, cmd.Params["channel_name"][0])
+				return client.ParseResponse("cid=10"), nil
+			case "setclientchannelgroup":
+				cgid = cmd.Params["cgid"][0]
+				cid = cmd.Params["cid"][0]
+				cldbid = cmd.Params["cldbid"][0]
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(config, &fakeStore{}, e)
+
+	u := &ts3.User{EveCorpTicker: "CORP", EveAlliTicker: "ALLI", TS3CLDBID: "5"}
+	s.assignChannelGroups(u)
+	require.Equal(t, []string{"ALLI CORP", "CORP Ops"}, created)
+	require.Equal(t, "9", cgid)
+	require.Equal(t, "10", cid)
+	require.Equal(t, "5", cldbid)
+
+	// Revoke must not create channels.
+	created = nil
+	config.TS3DefaultChannelGroupID = "8"
+	s.revokeChannelGroups(u)
+	require.Empty(t, created)
+}
@@ -0,0 +1,156 @@
+package darfkts3service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	client "github.com/darfk/ts3"
+
+	"github.com/prusya/eve-ts3-service/pkg/notify"
+	"github.com/prusya/eve-ts3-service/pkg/system"
+)
+
+const (
+	defaultCommandTimeout = 30 * time.Second
+	reconnectBackoff      = 5 * time.Second
+	maxReconnectBackoff   = 5 * time.Minute
+)
+
+// connect connects to ts3 server, logs in, selects virtual server and,
+// if subscribe is true, subscribes to server notifications.
+func (s *Service) connect(subscribe bool) {
+	cfg := s.system.Config()
+	// Connect to ts3 server.
+	c, err := dialQuery(cfg.TS3Address, s.connectionLost)
+	system.HandleError(err)
+	s.scheduler.setExecutor(c)
+
+	// Login.
+	_, err = s.scheduler.Exec(client.Login(cfg.TS3User, cfg.TS3Password))
+	s.handleConnectError(c, err)
+	// Select virtual server.
+	_, err = s.scheduler.Exec(client.Use(cfg.TS3ServerID))
+	s.handleConnectError(c, err)
+	if subscribe {
+		s.subscribe(c)
+	}
+
+	s.lock.Lock()
+	s.client = c
+	s.lock.Unlock()
+}
+
+// subscribe subscribes c to server notifications about new connections
+// and to private text messages with guest commands.
+func (s *Service) subscribe(c *queryClient) {
+	_, err := s.scheduler.Exec(client.Command{
+		Command: "servernotifyregister",
+		Params: map[string][]string{
+			"event": []string{"server"},
+		},
+	})
+	s.handleConnectError(c, err)
+	_, err = s.scheduler.Exec(client.Command{
+		Command: "servernotifyregister",
+		Params: map[string][]string{
+			"event": []string{"textprivate"},
+		},
+	})
+	s.handleConnectError(c, err)
+
+	c.NotifyHandler(s.eventHandler)
+}
+
+// handleConnectError closes c and panics if err is not nil.
+func (s *Service) handleConnectError(c *queryClient, err error) {
+	if err == nil {
+		return
+	}
+	s.scheduler.setExecutor(nil)
+	c.Close()
+	system.HandleError(err, serviceName+".connect")
+}
+
+// dropConnection closes current connection, which makes the service
+// reconnect.
+func (s *Service) dropConnection() {
+	s.lock.RLock()
+	c := s.client
+	s.lock.RUnlock()
+	if c != nil {
+		c.Close()
+	}
+}
+
+// connectionLost is called when connection c is closed. It starts
+// reconnecting if c is the current connection.
+func (s *Service) connectionLost(c *queryClient, err error) {
+	s.lock.Lock()
+	current := s.client == c
+	if current {
+		s.client = nil
+	}
+	term := s.term
+	s.lock.Unlock()
+
+	if current && term != nil {
+		s.scheduler.setExecutor(nil)
+		log.Printf("%s: connection lost: %s\n", serviceName, err)
+		s.notify(notify.ConnectionLost,
+			fmt.Sprintf("lost connection to ts3 server: %s", err), nil)
+		go s.reconnect(term)
+	}
+}
+
+// reconnect tries to connect to ts3 server with a growing delay until
+// it succeeds or term is closed.
+func (s *Service) reconnect(term <-chan struct{}) {
+	backoff := reconnectBackoff
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(backoff):
+		case <-term:
+			return
+		}
+
+		if s.tryConnect() {
+			log.Printf("%s: reconnected after %d attempts\n", serviceName,
+				attempt)
+			s.notify(notify.Reconnected,
+				fmt.Sprintf("reconnected to ts3 server after %d attempts",
+					attempt), nil)
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// tryConnect calls connect and reports whether it succeeded.
+func (s *Service) tryConnect() (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+	s.connect(true)
+
+	return true
+}
+
+// notify sends an event to the notify service if there is one.
+func (s *Service) notify(eventType, message string, fields map[string]string) {
+	if s.system.Notify == nil {
+		return
+	}
+	s.system.Notify.Notify(notify.Event{
+		Type:    eventType,
+		At:      time.Now().Unix(),
+		Message: message,
+		Fields:  fields,
+	})
+}
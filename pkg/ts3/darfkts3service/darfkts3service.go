@@ -1,16 +1,17 @@
 package darfkts3service
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 	"sync"
 	"time"
 
 	client "github.com/darfk/ts3"
 	"github.com/pkg/errors"
 
+	"github.com/prusya/eve-ts3-service/pkg/esi"
+	"github.com/prusya/eve-ts3-service/pkg/leader"
+	"github.com/prusya/eve-ts3-service/pkg/notify"
 	"github.com/prusya/eve-ts3-service/pkg/system"
 	"github.com/prusya/eve-ts3-service/pkg/ts3"
 )
@@ -22,95 +23,206 @@ const (
 // Service implements ts3.Service interface backed by darfk/ts3 lib.
 type Service struct {
 	system    *system.System
-	client    *client.Client
+	client    *queryClient
+	scheduler *scheduler
 	store     ts3.Store
-	registerQ map[string]registerRecord
+	validator ts3.Validator
+	esi       *esi.Client
+	// claimed lists IDs of registrations being matched right now.
+	claimed   map[int]bool
 	lock      sync.RWMutex
+	applyLock sync.Mutex
 	stopChan  chan struct{}
-}
-
-// userData defines a response from users validation server.
-type userData struct {
-	EveCharID     int32
-	EveCorpTicker string
-	EveAlliTicker string
-	Valid         bool
-}
-
-type registerRecord struct {
-	at   int64
-	user *ts3.User
+	// work tracks running jobs, so that shutdown waits for them.
+	work system.Tracker
+
+	// elector is nil when the service runs as a single instance.
+	elector      leader.Elector
+	campaignDone chan struct{}
+	// term is closed when the service stops leading. It is nil while
+	// the service is not the leader.
+	term chan struct{}
+
+	keepAliveJob        *job
+	registerQCleanupJob *job
+	validateUsersJob    *job
+	groupsCleanupJob    *job
+	auditGroupsJob      *job
+	affiliationJob      *job
+	onlineClientsJob    *job
+	grantsSyncJob       *job
 }
 
 // New creates a new service and prepares it to start.
-func New(system *system.System, store ts3.Store) *Service {
+func New(system *system.System, store ts3.Store,
+	validator ts3.Validator) *Service {
 	s := Service{
 		system:    system,
 		store:     store,
-		registerQ: make(map[string]registerRecord),
-		stopChan:  make(chan struct{}, 1),
+		validator: validator,
+		esi:       esi.New(system.Config().ESIBaseURL),
+		claimed:   make(map[int]bool),
+		stopChan:  make(chan struct{}),
 	}
+	s.scheduler = s.newScheduler(nil)
+	s.keepAliveJob = newJob(s.tracked(s.keepAlive))
+	s.registerQCleanupJob = newJob(s.tracked(s.registerQCleanup))
+	s.validateUsersJob = newJob(s.tracked(s.validateUsers))
+	s.groupsCleanupJob = newJob(s.tracked(s.groupsCleanup))
+	s.auditGroupsJob = newJob(s.tracked(s.auditGroups))
+	s.affiliationJob = newJob(s.tracked(s.checkAffiliations))
+	s.onlineClientsJob = newJob(s.tracked(s.matchOnlineClients))
+	s.grantsSyncJob = newJob(s.tracked(s.grantsSync))
 
 	s.system.TS3 = &s
 
 	return &s
 }
 
-// Start starts the service.
+// Start starts the service. A single instance leads right away, otherwise
+// the service campaigns for leadership in background.
 func (s *Service) Start() {
-	// Connect to ts3 server.
-	c, err := client.NewClient(s.system.Config.TS3Address)
-	system.HandleError(err)
-	// Login.
-	_, err = c.Exec(client.Login(s.system.Config.TS3User,
-		s.system.Config.TS3Password))
-	system.HandleError(err)
-	// Select virtual server.
-	_, err = c.Exec(client.Use(s.system.Config.TS3ServerID))
-	system.HandleError(err)
-	// Subscribe to server notifications to receive messages about new
-	// connections.
-	_, err = c.Exec(client.Command{
-		Command: "servernotifyregister",
-		Params: map[string][]string{
-			"event": []string{"server"},
-		},
-	})
-	system.HandleError(err)
-
-	s.client = c
-	s.client.NotifyHandler(s.eventHandler)
-
-	keepAliveT := time.NewTicker(30 * time.Second)
-	rqCleanupT := time.NewTicker(40 * time.Second)
-	validateUsersT := time.NewTicker(50 * time.Second)
-	go func() {
-		for {
-			select {
-			case <-keepAliveT.C:
-				go s.keepAlive()
-			case <-rqCleanupT.C:
-				go s.registerQCleanup()
-			case <-validateUsersT.C:
-				go s.ValidateUsers()
-			case <-s.stopChan:
-				fmt.Println("===STOP CHAN===")
-				keepAliveT.Stop()
-				rqCleanupT.Stop()
-				validateUsersT.Stop()
-				break
-			}
-		}
-	}()
+	if s.elector == nil {
+		s.lead()
+		return
+	}
+
+	s.campaignDone = make(chan struct{})
+	go s.campaign()
 }
 
-// Stop stops the Service.
+// UseElector makes the service share work with other replicas. Only the
+// leader holds ts3 connection and runs jobs. Must be called before Start.
+func (s *Service) UseElector(e leader.Elector) {
+	s.elector = e
+}
+
+// lead connects to ts3 server and schedules periodic jobs until the term
+// ends.
+func (s *Service) lead() {
+	term := make(chan struct{})
+	s.lock.Lock()
+	s.term = term
+	s.lock.Unlock()
+
+	s.connect(true)
+	s.adoptGroups(nil)
+
+	cfg := s.system.Config()
+	jitter := time.Duration(cfg.TS3IntervalJitter) * time.Second
+	go s.schedule(s.keepAliveJob,
+		intervalOrDefault(cfg.TS3KeepAliveInterval, defaultKeepAliveInterval),
+		jitter, term)
+	go s.schedule(s.registerQCleanupJob,
+		intervalOrDefault(cfg.TS3RegisterQCleanupInterval,
+			defaultRegisterQCleanupInterval),
+		jitter, term)
+	go s.schedule(s.validateUsersJob,
+		intervalOrDefault(cfg.TS3ValidateUsersInterval,
+			defaultValidateUsersInterval),
+		jitter, term)
+	go s.schedule(s.groupsCleanupJob,
+		intervalOrDefault(cfg.TS3GroupsCleanupInterval,
+			defaultGroupsCleanupInterval),
+		jitter, term)
+	go s.schedule(s.auditGroupsJob,
+		intervalOrDefault(cfg.TS3AuditGroupsInterval,
+			defaultAuditGroupsInterval),
+		jitter, term)
+	// Catch up with grants and registrations which changed while
+	// the service was down or another replica was leading.
+	s.grantsSyncJob.start()
+	s.onlineClientsJob.start()
+	go s.schedule(s.grantsSyncJob,
+		intervalOrDefault(cfg.TS3GrantsSyncInterval,
+			defaultGrantsSyncInterval),
+		jitter, term)
+	if cfg.TS3OnlineClientsInterval > 0 {
+		go s.schedule(s.onlineClientsJob,
+			time.Duration(cfg.TS3OnlineClientsInterval)*time.Second, jitter,
+			term)
+	}
+	if cfg.ESIAffiliationInterval > 0 {
+		go s.schedule(s.affiliationJob,
+			time.Duration(cfg.ESIAffiliationInterval)*time.Second, jitter,
+			term)
+	}
+}
+
+// Leader reports whether the service holds ts3 connection and runs jobs.
+func (s *Service) Leader() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.term != nil
+}
+
+// endTerm stops scheduling jobs. Running jobs are not interrupted.
+func (s *Service) endTerm() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.term != nil {
+		close(s.term)
+		s.term = nil
+	}
+}
+
+// Stop stops the Service waiting for running jobs to finish.
 func (s *Service) Stop() {
-	s.stopChan <- struct{}{}
-	if s.client != nil {
-		s.client.ExecString("quit")
-		s.client.Close()
+	s.Shutdown(context.Background())
+}
+
+// Shutdown stops scheduling jobs, waits for running ones until ctx is
+// done, disconnects from ts3 server and gives up leadership.
+func (s *Service) Shutdown(ctx context.Context) error {
+	close(s.stopChan)
+	if s.campaignDone != nil {
+		select {
+		case <-s.campaignDone:
+		case <-ctx.Done():
+		}
 	}
+	s.endTerm()
+	err := s.work.Wait(ctx)
+	s.disconnect()
+	if s.elector != nil {
+		s.elector.Release()
+	}
+
+	return err
+}
+
+// disconnect closes current connection to ts3 server if there is one.
+func (s *Service) disconnect() {
+	s.lock.Lock()
+	c := s.client
+	s.client = nil
+	s.lock.Unlock()
+	if c != nil {
+		s.scheduler.Exec(client.Command{Command: "quit"})
+		s.scheduler.setExecutor(nil)
+		c.Close()
+	}
+}
+
+// newScheduler creates a scheduler for e according to ts3 flood settings
+// from the config. Whitelisted hosts are not rate limited.
+// Commands time out after TS3CommandTimeout seconds.
+func (s *Service) newScheduler(e executor) *scheduler {
+	c := s.system.Config()
+	commands := c.TS3FloodCommands
+	if c.TS3Whitelisted == "true" {
+		commands = 0
+	}
+
+	sch := newScheduler(e, commands, time.Duration(c.TS3FloodTime)*time.Second,
+		c.TS3FloodRetries)
+	sch.timeout = intervalOrDefault(c.TS3CommandTimeout,
+		defaultCommandTimeout)
+	sch.onTimeout = s.dropConnection
+
+	return sch
 }
 
 // GetStore returns ts3.Store.
@@ -122,95 +234,184 @@ func recoverPanic() {
 	recover()
 }
 
-// ValidateUsers keeps user records up to date, assigns proper ts3 server goups,
-// deletes users from ts3 server if they don't have access to ts3 service.
+// ValidateUsers runs users validation in the calling goroutine unless
+// another validation run is in progress.
 func (s *Service) ValidateUsers() {
-	defer recoverPanic()
+	s.validateUsersJob.tryRun()
+}
+
+// TriggerValidateUsers starts users validation in background.
+// It returns false if validation is already in progress.
+func (s *Service) TriggerValidateUsers() bool {
+	return s.validateUsersJob.start()
+}
+
+// ValidateUsersRunning reports whether users validation is in progress.
+func (s *Service) ValidateUsersRunning() bool {
+	return s.validateUsersJob.isRunning()
+}
+
+// validateUsers keeps user records up to date, assigns proper ts3 server goups,
+// deletes users from ts3 server if they don't have access to ts3 service.
+func (s *Service) validateUsers() {
+	defer func() {
+		if r := recover(); r != nil {
+			s.notify(notify.ValidationFailed,
+				fmt.Sprintf("users validation failed: %s", r), nil)
+		}
+	}()
 
 	// We need to check only active users.
-	ids := s.store.ActiveUsersCharIDs()
-
-	// Send ids to the validation server.
-	payload, _ := json.Marshal(ids)
-	resp, err := http.Post(s.system.Config.UsersValidationEndpoint,
-		"application/json", bytes.NewBuffer(payload))
-	system.HandleError(err, serviceName+".ValidateUsers http.Post", ids)
-	if resp.StatusCode != 200 {
-		err = errors.New("non 200 response from validation server")
-		system.HandleError(err, serviceName+".ValidateUsers", resp.StatusCode)
+	// Guests are not members, they are not validated.
+	var users []*ts3.User
+	for _, u := range s.store.Users() {
+		if u.Active && !u.Guest {
+			users = append(users, u)
+		}
+	}
+	if len(users) == 0 {
+		return
 	}
 
-	usersData := []userData{}
-	d := json.NewDecoder(resp.Body)
-	d.UseNumber()
-	d.Decode(&usersData)
-	resp.Body.Close()
-
-	// Process response from the validation server.
-	users := s.store.Users()
-	for _, u := range usersData {
+	// Process statuses reported by the validator.
+	statuses := s.validator.Validate(users)
+	for _, st := range statuses {
 		for _, user := range users {
-			if user.EveCharID == u.EveCharID {
-				// Invalid users should only be removed from server groups.
-				if !u.Valid {
-					s.allServerGroupsDelClient(user.TS3CLDBID)
-					s.store.SetUserInactiveByUID(user.TS3UID)
-					continue
-				}
-
-				// Move user to a proper group if corp or alli has changed.
-				if user.EveCorpTicker != u.EveCorpTicker ||
-					user.EveAlliTicker != u.EveAlliTicker {
-					// Remove user from current group.
-					currentGroup := fmt.Sprintf("%s %s", user.EveAlliTicker,
-						user.EveCorpTicker)
-					found, sgid := s.serverGroupByName(currentGroup)
-					if found {
-						s.serverGroupDelClient(sgid, user.TS3CLDBID)
-					}
-
-					// Add user to a new group.
-					newGroup := fmt.Sprintf("%s %s", u.EveAlliTicker,
-						u.EveCorpTicker)
-					found, sgid = s.serverGroupByName(newGroup)
-					if !found {
-						sgid = s.serverGroupCopy(newGroup)
-					}
-					s.serverGroupAddClient(sgid, user.TS3CLDBID)
-
-					// Finally, update store record.
-					user.EveCorpTicker = u.EveCorpTicker
-					user.EveAlliTicker = u.EveAlliTicker
-					s.store.UpdateUser(user)
-				}
+			if user.EveCharID == st.EveCharID {
+				s.applyUserStatus(user, st)
 			}
 		}
 	}
 }
 
-// allServerGroupsDelClient removes user from all server groups
-// except `server admin`.
-func (s *Service) allServerGroupsDelClient(cldbid string) {
-	resp, err := s.client.Exec(client.Command{
-		Command: "servergroupsbyclientid",
-		Params: map[string][]string{
-			"cldbid": []string{cldbid},
-		},
-	})
-	system.HandleError(err, serviceName+".deleteTS3User")
+// ApplyUserStatus applies status reported for an eve character to all
+// active users of the character right away.
+// It returns the number of users the status was applied to.
+func (s *Service) ApplyUserStatus(st ts3.UserStatus) int {
+	users := s.store.UsersByCharID(st.EveCharID)
+	applied := 0
+	for _, user := range users {
+		if s.applyUserStatus(user, st) {
+			applied++
+		}
+	}
 
-	for _, group := range resp.Params {
-		// Skip `server admin` group.
-		if group["sgid"] == "6" {
-			continue
+	return applied
+}
+
+// applyUserStatus removes invalid user or moves valid user to a proper group
+// if corp or alli has changed. Inactive and guest users are left as is.
+// It reports whether user is an active member.
+func (s *Service) applyUserStatus(user *ts3.User, st ts3.UserStatus) bool {
+	if !user.Active || user.Guest {
+		return false
+	}
+
+	// Periodic validation and pushed statuses must not interleave
+	// on the same user.
+	s.applyLock.Lock()
+	defer s.applyLock.Unlock()
+
+	// Invalid users are removed according to removal rules.
+	if !st.Valid {
+		s.removeUser(user)
+		s.store.SetUserInactiveByUID(user.TS3UID)
+		user.Active = false
+		return true
+	}
+
+	// Ticker and name changes don't move users between groups.
+	if !affiliationChanged(user, st) {
+		if updateAffiliation(user, st) {
+			s.store.UpdateUser(user)
 		}
-		s.serverGroupDelClient(group["sgid"], cldbid)
+		return true
+	}
+
+	// Remove user from current group.
+	currentGroup := groupName(user)
+	found, sgid := s.userGroup(user, false)
+	if found {
+		s.serverGroupDelClient(sgid, user.TS3CLDBID)
 	}
+	s.revokeChannelGroups(user)
+
+	// Add user to a new group.
+	updateAffiliation(user, st)
+	newGroup := groupName(user)
+	_, sgid = s.userGroup(user, true)
+	s.serverGroupAddClient(sgid, user.TS3CLDBID)
+
+	s.notify(notify.CorpChanged,
+		fmt.Sprintf("%s moved from %q to %q", user.EveCharName,
+			currentGroup, newGroup),
+		userFields(user))
+
+	// Move user to channel groups of the new corp.
+	s.assignChannelGroups(user)
+
+	// Finally, update store record.
+	s.store.UpdateUser(user)
+
+	return true
+}
+
+// affiliationChanged checks whether st reports a different corp or alli.
+// IDs are compared when both sides know them, tickers otherwise.
+func affiliationChanged(user *ts3.User, st ts3.UserStatus) bool {
+	if user.EveCorpID != 0 && st.EveCorpID != 0 {
+		return user.EveCorpID != st.EveCorpID || user.EveAlliID != st.EveAlliID
+	}
+
+	return user.EveCorpTicker != st.EveCorpTicker ||
+		user.EveAlliTicker != st.EveAlliTicker
+}
+
+// matchAffiliation checks whether user belongs to the corp and alli of
+// a rule. Zero id and empty ticker match any. Tickers are only compared
+// when the id is zero, since they can change.
+func matchAffiliation(user *ts3.User, corpID, alliID int32, corpTicker,
+	alliTicker string) bool {
+	switch {
+	case corpID != 0:
+		if corpID != user.EveCorpID {
+			return false
+		}
+	case corpTicker != "" && corpTicker != user.EveCorpTicker:
+		return false
+	}
+	switch {
+	case alliID != 0:
+		return alliID == user.EveAlliID
+	case alliTicker != "":
+		return alliTicker == user.EveAlliTicker
+	}
+
+	return true
+}
+
+// updateAffiliation copies corp and alli reported by st to user.
+// Unknown IDs and names are left as is.
+// It reports whether user was changed.
+func updateAffiliation(user *ts3.User, st ts3.UserStatus) bool {
+	before := *user
+	user.EveCorpTicker = st.EveCorpTicker
+	user.EveAlliTicker = st.EveAlliTicker
+	if st.EveCorpID != 0 {
+		user.EveCorpID = st.EveCorpID
+		user.EveAlliID = st.EveAlliID
+	}
+	if st.EveCorpName != "" {
+		user.EveCorpName = st.EveCorpName
+		user.EveAlliName = st.EveAlliName
+	}
+
+	return *user != before
 }
 
 // serverGroupDelClient removes user from a server group.
 func (s *Service) serverGroupDelClient(sgid, cldbid string) {
-	_, err := s.client.Exec(client.Command{
+	_, err := s.scheduler.Exec(client.Command{
 		Command: "servergroupdelclient",
 		Params: map[string][]string{
 			"sgid":   []string{sgid},
@@ -223,7 +424,7 @@ func (s *Service) serverGroupDelClient(sgid, cldbid string) {
 
 // serverGroupAddClient adds user to a server group.
 func (s *Service) serverGroupAddClient(sgid, cldbid string) {
-	_, err := s.client.Exec(client.Command{
+	_, err := s.scheduler.Exec(client.Command{
 		Command: "servergroupaddclient",
 		Params: map[string][]string{
 			"sgid":   []string{sgid},
@@ -235,11 +436,14 @@ func (s *Service) serverGroupAddClient(sgid, cldbid string) {
 }
 
 // serverGroupCopy creates a new group by copying the reference group.
-func (s *Service) serverGroupCopy(groupName string) string {
-	resp, err := s.client.Exec(client.Command{
+// The group is recorded in the store as managed by the service for members
+// of provided corp and alli.
+func (s *Service) serverGroupCopy(groupName string, corpID,
+	alliID int32) string {
+	resp, err := s.scheduler.Exec(client.Command{
 		Command: "servergroupcopy",
 		Params: map[string][]string{
-			"ssgid": []string{s.system.Config.TS3ReferenceGroupID},
+			"ssgid": []string{s.system.Config().TS3ReferenceGroupID},
 			"tsgid": []string{"0"},
 			"type":  []string{"1"},
 			"name":  []string{groupName},
@@ -254,33 +458,93 @@ func (s *Service) serverGroupCopy(groupName string) string {
 			"groupName="+groupName, resp.Params)
 	}
 
+	s.store.CreateGroup(&ts3.Group{
+		SGID:      sgid,
+		Name:      groupName,
+		EveCorpID: corpID,
+		EveAlliID: alliID,
+		CreatedAt: time.Now().Unix(),
+	})
+
 	return sgid
 }
 
-// serverGroupByName returns whether server group exists and its sgid.
-func (s *Service) serverGroupByName(groupName string) (bool, string) {
-	resp, err := s.client.Exec(client.Command{
-		Command: "servergrouplist",
-	})
-	system.HandleError(err, serviceName+".serverGroupByName", "groupName="+groupName)
+// userGroup returns whether the server group for members of user's corp
+// and alli exists and its sgid. Managed groups are matched by corp and alli
+// IDs so ticker renames don't matter, other groups are matched by name.
+// A missing group is created if create is true.
+func (s *Service) userGroup(u *ts3.User, create bool) (bool, string) {
+	name := groupName(u)
+	names := s.serverGroupNames()
+
+	managed := make(map[string]*ts3.Group)
+	for _, g := range s.store.Groups() {
+		managed[g.SGID] = g
+		if u.EveCorpID == 0 || g.EveCorpID != u.EveCorpID ||
+			g.EveAlliID != u.EveAlliID {
+			continue
+		}
+		if _, ok := names[g.SGID]; ok {
+			return true, g.SGID
+		}
+	}
 
-	for _, group := range resp.Params {
-		if group["name"] == groupName {
-			return true, group["sgid"]
+	for sgid, n := range names {
+		if n != name {
+			continue
+		}
+		g, ok := managed[sgid]
+		if !ok {
+			// Keep track of groups created before the service did.
+			s.adoptGroup(sgid, n, u)
+			return true, sgid
 		}
+		// The name belongs to a group of another corp which used
+		// the same tickers.
+		if g.EveCorpID != 0 && u.EveCorpID != 0 {
+			continue
+		}
+		// Remember ids of groups created before ids were tracked.
+		if g.EveCorpID == 0 && u.EveCorpID != 0 {
+			g.EveCorpID = u.EveCorpID
+			g.EveAlliID = u.EveAlliID
+			s.store.UpdateGroup(g)
+		}
+		return true, sgid
 	}
 
-	return false, "sgid"
+	if !create {
+		return false, ""
+	}
+
+	return true, s.serverGroupCopy(name, u.EveCorpID, u.EveAlliID)
+}
+
+// groupName returns a name of the server group for members of user's corp
+// and alli.
+func groupName(u *ts3.User) string {
+	return fmt.Sprintf("%s %s", u.EveAlliTicker, u.EveCorpTicker)
 }
 
-// CreateRegisterRecord creates a new register record.
+// CreateRegisterRecord stores a new registration.
+// On the leader, users who are already connected are matched right away
+// in background. Other replicas leave it to the leader.
 func (s *Service) CreateRegisterRecord(u *ts3.User) {
-	s.lock.Lock()
-	s.registerQ[u.EveCharName] = registerRecord{
-		at:   time.Now().Unix(),
-		user: u,
-	}
-	s.lock.Unlock()
+	s.store.CreateRegistration(&ts3.Registration{
+		EveCharID:     u.EveCharID,
+		EveCharName:   u.EveCharName,
+		EveCorpID:     u.EveCorpID,
+		EveCorpName:   u.EveCorpName,
+		EveCorpTicker: u.EveCorpTicker,
+		EveAlliID:     u.EveAlliID,
+		EveAlliName:   u.EveAlliName,
+		EveAlliTicker: u.EveAlliTicker,
+		Guest:         u.Guest,
+		Token:         newRegistrationToken(),
+		CreatedAt:     time.Now().Unix(),
+	})
+
+	go s.tracked(s.matchOnlineClients)()
 }
 
 // eventHandler receives server events.
@@ -288,6 +552,14 @@ func (s *Service) CreateRegisterRecord(u *ts3.User) {
 func (s *Service) eventHandler(n client.Notification) {
 	defer recoverPanic()
 
+	// Text messages may carry guest commands from admins. They are
+	// handled in background, since responses are not read while
+	// the handler is running.
+	if n.Type == "notifytextmessage" {
+		go s.tracked(func() { s.guestCommand(n.Params[0]) })()
+		return
+	}
+
 	// We need only `notifycliententerview` event with `reasonid=0`.
 	// This event occurs when a user connects to the server.
 	if n.Type != "notifycliententerview" {
@@ -299,37 +571,23 @@ func (s *Service) eventHandler(n client.Notification) {
 
 	cluid := n.Params[0]["client_unique_identifier"]
 	clnickname := n.Params[0]["client_nickname"]
+	cldescription := n.Params[0]["client_description"]
 	cldbid := n.Params[0]["client_database_id"]
 
-	// Check if connected user is in the register queue.
-	record, ok := s.registerQ[clnickname]
-	if !ok {
-		return
-	}
-	// Check if the registration record didn't expire.
-	now := time.Now().Unix()
-	if record.at+int64(s.system.Config.TS3RegisterTimer) < now {
-		return
-	}
+	// Registration sends commands, so it runs in background too.
+	go s.tracked(func() {
+		defer recoverPanic()
+		s.completeRegistration(clnickname, cldescription, cluid, cldbid)
+	})()
+}
 
-	// Add user to the proper group.
-	groupName := fmt.Sprintf("%s %s", record.user.EveAlliTicker,
-		record.user.EveCorpTicker)
-	found, sgid := s.serverGroupByName(groupName)
-	// If group not found, create it.
-	if !found {
-		sgid = s.serverGroupCopy(groupName)
-	}
-	s.serverGroupAddClient(sgid, cldbid)
-
-	// Finally, store user record in the db.
-	record.user.TS3CLDBID = cldbid
-	record.user.TS3UID = cluid
-	record.user.Active = true
-	if s.store.TS3UIDExists(cluid) {
-		s.store.UpdateUserByUID(record.user)
-	} else {
-		s.store.CreateUser(record.user)
+// userFields returns user's data to be attached to notifications.
+func userFields(u *ts3.User) map[string]string {
+	return map[string]string{
+		"character": u.EveCharName,
+		"corp":      u.EveCorpTicker,
+		"alliance":  u.EveAlliTicker,
+		"ts3_uid":   u.TS3UID,
 	}
 }
 
@@ -338,18 +596,15 @@ func (s *Service) eventHandler(n client.Notification) {
 func (s *Service) keepAlive() {
 	defer recoverPanic()
 
-	_, err := s.client.Exec(client.Version())
+	_, err := s.scheduler.Exec(client.Version())
 	system.HandleError(err, serviceName+".keepAlive")
 }
 
-// registerQCleanup removes expired register records.
+// registerQCleanup removes registrations which expired longer than
+// registrationStatusTTL ago. Until then their status is still reported.
 func (s *Service) registerQCleanup() {
-	now := time.Now().Unix()
-	s.lock.Lock()
-	for k, v := range s.registerQ {
-		if v.at+int64(s.system.Config.TS3RegisterTimer) < now {
-			delete(s.registerQ, k)
-		}
-	}
-	s.lock.Unlock()
+	defer recoverPanic()
+
+	ttl := s.registerTimer() + int64(registrationStatusTTL/time.Second)
+	s.store.DeleteRegistrationsBefore(time.Now().Unix() - ttl)
 }
@@ -1,8 +1,11 @@
 package darfkts3service
 
 import (
+	"sync"
 	"testing"
+	"time"
 
+	client "github.com/darfk/ts3"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/require"
 
@@ -12,44 +15,369 @@ import (
 )
 
 func TestDarfkts3service(t *testing.T) {
-	sys := &system.System{
-		Config: &system.Config{
-			TS3RegisterTimer: 300,
-		},
-	}
+	sys := system.NewWithConfig(&system.Config{
+		TS3RegisterTimer: 300,
+	})
 	db := &sqlx.DB{}
 	store := pgts3store.New(db)
 
 	t.Run("TestNew", func(t *testing.T) {
-		ts3service := New(sys, store)
+		ts3service := New(sys, store, nil)
 		require.Equal(t, ts3service, sys.TS3)
 	})
 
 	t.Run("TestGetStore", func(t *testing.T) {
-		ts3service := New(sys, store)
+		ts3service := New(sys, store, nil)
 		require.Equal(t, store, ts3service.GetStore())
 	})
 
 	t.Run("TestCreateRegisterRecord", func(t *testing.T) {
-		ts3service := New(sys, store)
+		store := &fakeStore{}
+		ts3service := New(sys, store, nil)
 		user := &ts3.User{
+			EveCharID:   1,
 			EveCharName: "test user",
 		}
 		ts3service.CreateRegisterRecord(user)
-		record, ok := ts3service.registerQ[user.EveCharName]
-		require.True(t, ok)
-		require.Equal(t, user, record.user)
+		require.Len(t, store.registrations, 1)
+		require.Equal(t, user, registrationUser(store.registrations[0]))
 	})
 
 	t.Run("TestRegisterQCleanup", func(t *testing.T) {
-		ts3service := New(sys, store)
-		ts3service.lock.Lock()
-		ts3service.registerQ["test user 2"] = registerRecord{
-			at: 1,
-		}
-		ts3service.lock.Unlock()
+		store := &fakeStore{registrations: []*ts3.Registration{
+			{ID: 2, EveCharName: "test user", CreatedAt: time.Now().Unix()},
+			{ID: 1, EveCharName: "test user 2", CreatedAt: 1},
+		}}
+		ts3service := New(sys, store, nil)
 		ts3service.registerQCleanup()
-		_, ok := ts3service.registerQ["test user 2"]
-		require.False(t, ok)
+		require.Len(t, store.registrations, 1)
+		require.Equal(t, "test user", store.registrations[0].EveCharName)
+	})
+}
+
+// fakeStore keeps records in memory. Methods not overridden panic
+// through the nil embedded interface.
+type fakeStore struct {
+	ts3.Store
+	users  []*ts3.User
+	groups []*ts3.Group
+	events []*ts3.AuditEvent
+	grants []*ts3.Grant
+	guests []*ts3.GuestRequest
+
+	// lock guards registrations which are polled by status requests.
+	lock          sync.Mutex
+	registrations []*ts3.Registration
+}
+
+func (s *fakeStore) Users() []*ts3.User {
+	return s.users
+}
+
+func (s *fakeStore) UsersByCharID(charID int32) []*ts3.User {
+	var users []*ts3.User
+	for _, u := range s.users {
+		if u.EveCharID == charID {
+			users = append(users, u)
+		}
+	}
+
+	return users
+}
+
+func (s *fakeStore) CreateUser(u *ts3.User) {
+	s.users = append(s.users, u)
+}
+
+func (s *fakeStore) TS3UIDExists(uid string) bool {
+	for _, u := range s.users {
+		if u.TS3UID == uid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *fakeStore) UpdateUser(u *ts3.User) {}
+
+func (s *fakeStore) SetUserInactiveByUID(uid string) {
+	for _, u := range s.users {
+		if u.TS3UID == uid {
+			u.Active = false
+		}
+	}
+}
+
+func (s *fakeStore) CreateGroup(g *ts3.Group) {
+	s.groups = append(s.groups, g)
+}
+
+func (s *fakeStore) Groups() []*ts3.Group {
+	return append([]*ts3.Group{}, s.groups...)
+}
+
+func (s *fakeStore) UpdateGroup(g *ts3.Group) {}
+
+func (s *fakeStore) DeleteGroup(sgid string) {
+	for i, g := range s.groups {
+		if g.SGID == sgid {
+			s.groups = append(s.groups[:i], s.groups[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *fakeStore) CreateAuditEvent(e *ts3.AuditEvent) {
+	s.events = append(s.events, e)
+}
+
+func (s *fakeStore) PendingAuditEventExists(kind, cldbid, sgid string) bool {
+	for _, e := range s.events {
+		if e.Kind == kind && e.TS3CLDBID == cldbid && e.SGID == sgid &&
+			!e.Reviewed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *fakeStore) CreateGrant(g *ts3.Grant) {
+	g.ID = len(s.grants) + 1
+	s.grants = append(s.grants, g)
+}
+
+func (s *fakeStore) Grants() []*ts3.Grant {
+	return s.grants
+}
+
+func (s *fakeStore) UpdateGrant(g *ts3.Grant) {}
+
+func (s *fakeStore) CreateGuestRequest(r *ts3.GuestRequest) {
+	r.ID = len(s.guests) + 1
+	s.guests = append(s.guests, r)
+}
+
+// GuestRequests returns copies of requests, as a database would.
+func (s *fakeStore) GuestRequests() []*ts3.GuestRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	requests := make([]*ts3.GuestRequest, 0, len(s.guests))
+	for _, r := range s.guests {
+		c := *r
+		requests = append(requests, &c)
+	}
+
+	return requests
+}
+
+func (s *fakeStore) UpdateGuestRequest(r *ts3.GuestRequest) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, stored := range s.guests {
+		if stored.ID == r.ID {
+			c := *r
+			s.guests[i] = &c
+		}
+	}
+}
+
+func (s *fakeStore) DecideGuestRequest(r *ts3.GuestRequest) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, stored := range s.guests {
+		if stored.ID == r.ID && stored.Status == ts3.GuestPending {
+			c := *r
+			s.guests[i] = &c
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *fakeStore) CreateRegistration(r *ts3.Registration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r.ID = len(s.registrations) + 1
+	s.registrations = append([]*ts3.Registration{r}, s.registrations...)
+}
+
+func (s *fakeStore) Registrations(since int64) []*ts3.Registration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var registrations []*ts3.Registration
+	for _, r := range s.registrations {
+		if r.CreatedAt >= since {
+			registrations = append(registrations, r)
+		}
+	}
+
+	return registrations
+}
+
+func (s *fakeStore) UpdateRegistration(r *ts3.Registration) {}
+
+func (s *fakeStore) DeleteRegistrationsBefore(at int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var registrations []*ts3.Registration
+	for _, r := range s.registrations {
+		if r.CreatedAt >= at {
+			registrations = append(registrations, r)
+		}
+	}
+	s.registrations = registrations
+}
+
+// newTestService creates a Service connected to a fake ts3 server.
+func newTestService(config *system.Config, store ts3.Store,
+	e *fakeExecutor) *Service {
+	sys := system.NewWithConfig(config)
+	s := New(sys, store, nil)
+	s.scheduler = newScheduler(e, 0, 0, 0)
+	// Tests run as the leader of a single instance.
+	s.term = make(chan struct{})
+
+	return s
+}
+
+func TestUserGroup(t *testing.T) {
+	store := &fakeStore{
+		groups: []*ts3.Group{
+			{SGID: "10", Name: "ALLI OLD", EveCorpID: 100, EveAlliID: 200},
+			{SGID: "11", Name: "ALLI OTHER", EveCorpID: 101, EveAlliID: 200},
+		},
+	}
+	var copied []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "servergrouplist":
+				return client.ParseResponse(`sgid=10 name=ALLI\sOLD type=1|` +
+					`sgid=11 name=ALLI\sOTHER type=1|sgid=12 name=MANUAL\sGROUP type=1`), nil
+			case "servergroupcopy":
+				copied = append(copied, cmd.Params["name"][0])
+				return client.ParseResponse(`sgid=13`), nil
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(&system.Config{}, store, e)
+
+	// Managed group is found by ids after ticker rename.
+	found, sgid := s.userGroup(&ts3.User{EveCorpID: 100, EveAlliID: 200,
+		EveCorpTicker: "NEW", EveAlliTicker: "ALLI"}, false)
+	require.True(t, found)
+	require.Equal(t, "10", sgid)
+
+	// Unmanaged group is found by name.
+	found, sgid = s.userGroup(&ts3.User{EveCorpTicker: "GROUP",
+		EveAlliTicker: "MANUAL"}, false)
+	require.True(t, found)
+	require.Equal(t, "12", sgid)
+	// and is managed from now on.
+	require.Len(t, store.groups, 3)
+	require.Equal(t, "12", store.groups[2].SGID)
+
+	// A group with the same name for another corp is not reused.
+	found, _ = s.userGroup(&ts3.User{EveCorpID: 102, EveAlliID: 200,
+		EveCorpTicker: "OTHER", EveAlliTicker: "ALLI"}, false)
+	require.False(t, found)
+
+	found, sgid = s.userGroup(&ts3.User{EveCorpID: 103, EveCorpTicker: "X",
+		EveAlliTicker: "Y"}, true)
+	require.True(t, found)
+	require.Equal(t, "13", sgid)
+	require.Equal(t, []string{"Y X"}, copied)
+	require.Equal(t, int32(103), store.groups[3].EveCorpID)
+}
+
+func TestApplyUserStatus(t *testing.T) {
+	newStore := func() *fakeStore {
+		return &fakeStore{
+			users: []*ts3.User{
+				{EveCharID: 1, EveCorpTicker: "OLD", EveAlliTicker: "ALLI",
+					TS3UID: "a", TS3CLDBID: "1", Active: true},
+				{EveCharID: 1, TS3UID: "b", TS3CLDBID: "2"},
+				{EveCharID: 2, TS3UID: "c", TS3CLDBID: "3", Active: true},
+			},
+		}
+	}
+	var added []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "servergrouplist":
+				return client.ParseResponse(
+					`sgid=10 name=ALLI\sOLD type=1|sgid=11 name=ALLI\sNEW type=1`), nil
+			case "servergroupaddclient":
+				added = append(added, cmd.Params["sgid"][0]+":"+
+					cmd.Params["cldbid"][0])
+			}
+			return client.Response{}, nil
+		},
+	}
+
+	t.Run("TestCorpChanged", func(t *testing.T) {
+		store := newStore()
+		s := newTestService(&system.Config{}, store, e)
+		n := s.ApplyUserStatus(ts3.UserStatus{EveCharID: 1, Valid: true,
+			EveCorpTicker: "NEW", EveAlliTicker: "ALLI"})
+		require.Equal(t, 1, n)
+		require.Equal(t, []string{"11:1"}, added)
+		require.Equal(t, "NEW", store.users[0].EveCorpTicker)
+	})
+
+	t.Run("TestInvalid", func(t *testing.T) {
+		store := newStore()
+		store.users[0].EveCorpTicker = "NEW"
+		s := newTestService(&system.Config{}, store, e)
+		e.handler = func(cmd client.Command) (client.Response, error) {
+			return client.Response{}, nil
+		}
+		n := s.ApplyUserStatus(ts3.UserStatus{EveCharID: 1})
+		require.Equal(t, 1, n)
+		require.False(t, store.users[0].Active)
+	})
+
+	t.Run("TestIDsUpdated", func(t *testing.T) {
+		store := newStore()
+		s := newTestService(&system.Config{}, store, e)
+		n := s.ApplyUserStatus(ts3.UserStatus{EveCharID: 1, Valid: true,
+			EveCorpID: 100, EveCorpTicker: "OLD", EveAlliID: 200,
+			EveAlliTicker: "ALLI"})
+		require.Equal(t, 1, n)
+		require.Equal(t, int32(100), store.users[0].EveCorpID)
+		require.Equal(t, int32(200), store.users[0].EveAlliID)
+	})
+
+	t.Run("TestTickerRenamed", func(t *testing.T) {
+		store := newStore()
+		store.users[0].EveCorpID = 100
+		store.users[0].EveAlliID = 200
+		s := newTestService(&system.Config{}, store, e)
+		e.handler = func(cmd client.Command) (client.Response, error) {
+			t.Fatalf("unexpected command %q", cmd.Command)
+			return client.Response{}, nil
+		}
+		n := s.ApplyUserStatus(ts3.UserStatus{EveCharID: 1, Valid: true,
+			EveCorpID: 100, EveCorpName: "Corp", EveCorpTicker: "RENAMED",
+			EveAlliID: 200, EveAlliTicker: "ALLI"})
+		require.Equal(t, 1, n)
+		require.Equal(t, "RENAMED", store.users[0].EveCorpTicker)
+		require.Equal(t, "Corp", store.users[0].EveCorpName)
+	})
+
+	t.Run("TestUnknownChar", func(t *testing.T) {
+		s := newTestService(&system.Config{}, newStore(), e)
+		require.Equal(t, 0, s.ApplyUserStatus(ts3.UserStatus{EveCharID: 3}))
 	})
 }
@@ -0,0 +1,194 @@
+package darfkts3service
+
+import (
+	"log"
+	"regexp"
+	"time"
+
+	client "github.com/darfk/ts3"
+
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+const (
+	// errDuplicateEntry is returned by ts3 server when a client is already
+	// a member of a server group.
+	errDuplicateEntry = 2561
+
+	defaultGrantsSyncInterval = time.Minute
+)
+
+// CreateGrant stores g and applies it in background if it has started.
+// Zero StartsAt means the grant starts right away.
+// It returns false without storing g if its group is protected or is
+// the reference group, since granting those gives away admin rights.
+func (s *Service) CreateGrant(g *ts3.Grant) bool {
+	if !s.grantableGroup(g.SGID, "") {
+		return false
+	}
+
+	g.CreatedAt = time.Now().Unix()
+	if g.StartsAt == 0 {
+		g.StartsAt = g.CreatedAt
+	}
+	s.store.CreateGrant(g)
+
+	s.grantsSyncJob.start()
+
+	return true
+}
+
+// grantableGroup checks whether a server group may be granted. Protected
+// group patterns are only matched if name is known, replicas which are
+// not connected to ts3 server check ids only.
+func (s *Service) grantableGroup(sgid, name string) bool {
+	cfg := s.system.Config()
+	if sgid == cfg.TS3ReferenceGroupID {
+		return false
+	}
+	var patterns []*regexp.Regexp
+	if name != "" {
+		patterns = s.protectedGroupPatterns()
+	}
+
+	return !isProtectedGroup(sgid, name, cfg.TS3ProtectedGroupIDs, patterns)
+}
+
+// RevokeGrant expires a grant right away. The group is removed
+// in background.
+// It returns false if there is no such grant or it is already done.
+func (s *Service) RevokeGrant(id int) bool {
+	for _, g := range s.store.Grants() {
+		if g.ID != id || g.Done {
+			continue
+		}
+		g.ExpiresAt = time.Now().Unix()
+		s.store.UpdateGrant(g)
+		s.grantsSyncJob.start()
+		return true
+	}
+
+	return false
+}
+
+// grantsSync adds groups of started grants and removes groups of expired
+// ones. Grants are kept in the store so restarts don't lose them.
+func (s *Service) grantsSync() {
+	defer recoverPanic()
+
+	now := time.Now().Unix()
+	for _, g := range s.store.Grants() {
+		switch {
+		case g.Done:
+			continue
+		case g.ExpiresAt <= now:
+			if g.Applied && !s.removeGrant(g) {
+				continue
+			}
+			g.Applied = false
+			g.Done = true
+			s.store.UpdateGrant(g)
+			log.Printf("%s: grant %d of sgid=%s expired\n", serviceName, g.ID,
+				g.SGID)
+		case g.StartsAt <= now && !g.Applied:
+			// Protection may have changed since the grant was created.
+			if !s.grantableGroup(g.SGID, s.serverGroupNames()[g.SGID]) {
+				g.Done = true
+				s.store.UpdateGrant(g)
+				log.Printf("%s: grant %d of protected sgid=%s dropped\n",
+					serviceName, g.ID, g.SGID)
+				continue
+			}
+			if !s.applyGrant(g) {
+				continue
+			}
+			g.Applied = true
+			s.store.UpdateGrant(g)
+			log.Printf("%s: grant %d of sgid=%s applied\n", serviceName, g.ID,
+				g.SGID)
+		}
+	}
+}
+
+// applyGrant adds grant's targets to its server group.
+// It reports whether all targets were added.
+func (s *Service) applyGrant(g *ts3.Grant) bool {
+	cldbids, err := s.grantCLDBIDs(g)
+	if err != nil {
+		log.Printf("%s: grant %d: %s\n", serviceName, g.ID, err)
+		return false
+	}
+	if len(cldbids) == 0 {
+		log.Printf("%s: grant %d has no known clients yet\n", serviceName,
+			g.ID)
+		return false
+	}
+
+	for _, cldbid := range cldbids {
+		_, err := s.scheduler.Exec(client.Command{
+			Command: "servergroupaddclient",
+			Params: map[string][]string{
+				"sgid":   []string{g.SGID},
+				"cldbid": []string{cldbid},
+			},
+		})
+		if err != nil && errorID(err) != errDuplicateEntry {
+			log.Printf("%s: failed to apply grant %d to cldbid=%s: %s\n",
+				serviceName, g.ID, cldbid, err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// removeGrant removes grant's targets from its server group.
+// It returns false if ts3 server is unreachable and removal should be
+// retried later. Other failures are logged and not retried.
+func (s *Service) removeGrant(g *ts3.Grant) bool {
+	cldbids, err := s.grantCLDBIDs(g)
+	if err != nil {
+		log.Printf("%s: grant %d: %s\n", serviceName, g.ID, err)
+		return false
+	}
+
+	for _, cldbid := range cldbids {
+		_, err := s.scheduler.Exec(client.Command{
+			Command: "servergroupdelclient",
+			Params: map[string][]string{
+				"sgid":   []string{g.SGID},
+				"cldbid": []string{cldbid},
+			},
+		})
+		switch err {
+		case nil:
+		case errNotConnected, errCommandTimeout:
+			return false
+		default:
+			log.Printf("%s: failed to remove grant %d from cldbid=%s: %s\n",
+				serviceName, g.ID, cldbid, err)
+		}
+	}
+
+	return true
+}
+
+// grantCLDBIDs returns cldbids of grant's targets.
+func (s *Service) grantCLDBIDs(g *ts3.Grant) ([]string, error) {
+	if g.TS3UID != "" {
+		cldbid, err := s.clientDBID(g.TS3UID)
+		if cldbid == "" {
+			return nil, err
+		}
+		return []string{cldbid}, nil
+	}
+
+	var cldbids []string
+	for _, u := range s.store.UsersByCharID(g.EveCharID) {
+		if u.Active {
+			cldbids = append(cldbids, u.TS3CLDBID)
+		}
+	}
+
+	return cldbids, nil
+}
@@ -0,0 +1,113 @@
+package darfkts3service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestGrantsSync(t *testing.T) {
+	now := time.Now().Unix()
+	store := &fakeStore{
+		users: []*ts3.User{
+			{EveCharID: 1, TS3CLDBID: "3", Active: true},
+			{EveCharID: 1, TS3CLDBID: "4"},
+		},
+		grants: []*ts3.Grant{
+			{ID: 4, SGID: "23", TS3UID: "unknown", StartsAt: now - 10,
+				ExpiresAt: now + 100},
+			{ID: 1, SGID: "20", TS3UID: "uid", StartsAt: now - 10,
+				ExpiresAt: now + 100},
+			{ID: 2, SGID: "21", EveCharID: 1, StartsAt: now - 100,
+				ExpiresAt: now - 10, Applied: true},
+			{ID: 3, SGID: "22", EveCharID: 1, StartsAt: now + 100,
+				ExpiresAt: now + 200},
+		},
+	}
+	var commands []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "clientgetdbidfromuid":
+				if cmd.Params["cluid"][0] == "unknown" {
+					return client.Response{},
+						errors.New("ts3: database empty result set (1281)")
+				}
+				return client.ParseResponse(`cluid=uid cldbid=5`), nil
+			case "servergroupaddclient", "servergroupdelclient":
+				commands = append(commands, cmd.Command+" "+
+					cmd.Params["sgid"][0]+":"+cmd.Params["cldbid"][0])
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(&system.Config{}, store, e)
+
+	s.grantsSync()
+	require.Equal(t, []string{
+		"servergroupaddclient 20:5",
+		"servergroupdelclient 21:3",
+	}, commands)
+	require.False(t, store.grants[0].Applied)
+	require.True(t, store.grants[1].Applied)
+	require.True(t, store.grants[2].Done)
+	require.False(t, store.grants[2].Applied)
+	require.False(t, store.grants[3].Applied)
+
+	// Applied grants are not applied again.
+	commands = nil
+	s.grantsSync()
+	require.Empty(t, commands)
+
+	require.True(t, s.RevokeGrant(1))
+	require.False(t, s.RevokeGrant(2))
+	require.False(t, s.RevokeGrant(10))
+}
+
+func TestCreateGrantProtected(t *testing.T) {
+	now := time.Now().Unix()
+	store := &fakeStore{
+		grants: []*ts3.Grant{
+			{ID: 1, SGID: "30", TS3UID: "uid", StartsAt: now - 10,
+				ExpiresAt: now + 100},
+		},
+	}
+	var added []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "servergrouplist":
+				return client.ParseResponse(`sgid=30 name=Donor\sVIP type=1`), nil
+			case "clientgetdbidfromuid":
+				return client.ParseResponse(`cluid=uid cldbid=5`), nil
+			case "servergroupaddclient":
+				added = append(added, cmd.Params["sgid"][0])
+			}
+			return client.Response{}, nil
+		},
+	}
+	config := &system.Config{
+		TS3ReferenceGroupID:       "7",
+		TS3ProtectedGroupIDs:      []string{"6"},
+		TS3ProtectedGroupPatterns: []string{"^Donor"},
+	}
+	s := newTestService(config, store, e)
+
+	for _, sgid := range []string{"6", "7"} {
+		require.False(t, s.CreateGrant(&ts3.Grant{SGID: sgid, TS3UID: "uid",
+			ExpiresAt: now + 100}))
+	}
+	require.Len(t, store.grants, 1)
+
+	// Groups protected by name are dropped by the leader.
+	s.grantsSync()
+	require.Empty(t, added)
+	require.True(t, store.grants[0].Done)
+	require.False(t, store.grants[0].Applied)
+}
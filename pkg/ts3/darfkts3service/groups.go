@@ -0,0 +1,252 @@
+package darfkts3service
+
+import (
+	"log"
+	"regexp"
+	"time"
+
+	client "github.com/darfk/ts3"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+const (
+	// errEmptyResult is returned by ts3 server when a list command has
+	// nothing to list, e.g. a server group without members.
+	errEmptyResult = 1281
+	// errInvalidGroupID is returned by ts3 server when a server group
+	// does not exist.
+	errInvalidGroupID = 2560
+
+	defaultGroupsCleanupInterval = time.Hour
+)
+
+// groupsCleanup deletes managed server groups which stayed empty for longer
+// than configured TS3EmptyGroupTTL. Groups not created by the service,
+// including adopted ones, are never deleted.
+func (s *Service) groupsCleanup() {
+	defer recoverPanic()
+
+	ttl := int64(s.system.Config().TS3EmptyGroupTTL)
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, g := range s.store.Groups() {
+		members, exists := s.serverGroupClientList(g.SGID)
+		// Group was deleted manually, forget about it.
+		if !exists {
+			s.store.DeleteGroup(g.SGID)
+			continue
+		}
+		if g.Adopted {
+			continue
+		}
+
+		switch {
+		case len(members) > 0:
+			if g.EmptySince != 0 {
+				g.EmptySince = 0
+				s.store.UpdateGroup(g)
+			}
+		case g.EmptySince == 0:
+			g.EmptySince = now
+			s.store.UpdateGroup(g)
+		case g.EmptySince+ttl <= now:
+			log.Printf("%s: deleting empty group %q sgid=%s\n", serviceName,
+				g.Name, g.SGID)
+			s.serverGroupDel(g.SGID)
+			s.store.DeleteGroup(g.SGID)
+		}
+	}
+}
+
+// adoptGroups starts managing existing server groups named after tickers
+// of stored users, e.g. groups created before the service kept track of
+// its groups, so that invalid users are removed from them too. sgids are
+// adopted regardless of their names. Protected groups are never adopted.
+func (s *Service) adoptGroups(sgids []string) {
+	defer recoverPanic()
+
+	owners := make(map[string]*ts3.User)
+	for _, u := range s.store.Users() {
+		if u.EveCorpTicker != "" {
+			owners[groupName(u)] = u
+		}
+	}
+	listed := make(map[string]bool)
+	for _, sgid := range sgids {
+		listed[sgid] = true
+	}
+	managed := make(map[string]bool)
+	for _, g := range s.store.Groups() {
+		managed[g.SGID] = true
+	}
+
+	for sgid, name := range s.serverGroupNames() {
+		u, ok := owners[name]
+		if managed[sgid] || (!ok && !listed[sgid]) {
+			continue
+		}
+		if !ok {
+			u = &ts3.User{}
+		}
+		s.adoptGroup(sgid, name, u)
+	}
+}
+
+// adoptGroup stores a server group created outside of the service as
+// a managed group for members of u's corp and alli. Adopted groups are
+// never deleted. Protected groups and the reference group are skipped.
+func (s *Service) adoptGroup(sgid, name string, u *ts3.User) {
+	cfg := s.system.Config()
+	if sgid == cfg.TS3ReferenceGroupID ||
+		isProtectedGroup(sgid, name, cfg.TS3ProtectedGroupIDs,
+			s.protectedGroupPatterns()) {
+		return
+	}
+
+	log.Printf("%s: adopting group %q sgid=%s\n", serviceName, name, sgid)
+	s.store.CreateGroup(&ts3.Group{
+		SGID:      sgid,
+		Name:      name,
+		EveCorpID: u.EveCorpID,
+		EveAlliID: u.EveAlliID,
+		CreatedAt: time.Now().Unix(),
+		Adopted:   true,
+	})
+}
+
+// serverGroupNames returns names of regular server groups by sgid.
+func (s *Service) serverGroupNames() map[string]string {
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "servergrouplist",
+	})
+	system.HandleError(err, serviceName+".serverGroupNames")
+
+	names := make(map[string]string)
+	for _, group := range resp.Params {
+		if group["type"] == "1" {
+			names[group["sgid"]] = group["name"]
+		}
+	}
+
+	return names
+}
+
+// serverGroupClientList returns members of a server group and whether
+// the group exists. Every member has `cldbid`, `client_nickname` and
+// `client_unique_identifier` keys.
+func (s *Service) serverGroupClientList(sgid string) ([]map[string]string, bool) {
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "servergroupclientlist",
+		Params: map[string][]string{
+			"sgid":   []string{sgid},
+			"-names": []string{},
+		},
+	})
+	switch errorID(err) {
+	case errEmptyResult:
+		return nil, true
+	case errInvalidGroupID:
+		return nil, false
+	}
+	system.HandleError(err, serviceName+".serverGroupClientList", "sgid="+sgid)
+
+	var members []map[string]string
+	for _, member := range resp.Params {
+		if _, ok := member["cldbid"]; ok {
+			members = append(members, member)
+		}
+	}
+
+	return members, true
+}
+
+// serverGroupDel deletes a server group even if it has members.
+func (s *Service) serverGroupDel(sgid string) {
+	_, err := s.scheduler.Exec(client.Command{
+		Command: "servergroupdel",
+		Params: map[string][]string{
+			"sgid":  []string{sgid},
+			"force": []string{"1"},
+		},
+	})
+	system.HandleError(err, serviceName+".serverGroupDel", "sgid="+sgid)
+}
+
+// allServerGroupsDelClient removes user from all server groups managed by
+// the service except protected ones.
+func (s *Service) allServerGroupsDelClient(cldbid string) *ts3.RemovalReport {
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "servergroupsbyclientid",
+		Params: map[string][]string{
+			"cldbid": []string{cldbid},
+		},
+	})
+	system.HandleError(err, serviceName+".allServerGroupsDelClient",
+		"cldbid="+cldbid)
+
+	managed := make(map[string]bool)
+	for _, g := range s.store.Groups() {
+		managed[g.SGID] = true
+	}
+	patterns := s.protectedGroupPatterns()
+
+	report := &ts3.RemovalReport{CLDBID: cldbid}
+	for _, group := range resp.Params {
+		r := ts3.GroupRemoval{
+			SGID: group["sgid"],
+			Name: group["name"],
+		}
+		switch {
+		case isProtectedGroup(r.SGID, r.Name,
+			s.system.Config().TS3ProtectedGroupIDs, patterns):
+			r.Reason = "protected"
+		case !managed[r.SGID]:
+			r.Reason = "not managed"
+		}
+		if r.Reason != "" {
+			report.Skipped = append(report.Skipped, r)
+			continue
+		}
+
+		s.serverGroupDelClient(r.SGID, cldbid)
+		report.Removed = append(report.Removed, r)
+	}
+
+	return report
+}
+
+// protectedGroupPatterns compiles configured TS3ProtectedGroupPatterns.
+func (s *Service) protectedGroupPatterns() []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, p := range s.system.Config().TS3ProtectedGroupPatterns {
+		re, err := regexp.Compile(p)
+		system.HandleError(err, serviceName+".protectedGroupPatterns",
+			"pattern="+p)
+		patterns = append(patterns, re)
+	}
+
+	return patterns
+}
+
+// isProtectedGroup checks whether a server group is listed in ids or its
+// name matches any of patterns.
+func isProtectedGroup(sgid, name string, ids []string,
+	patterns []*regexp.Regexp) bool {
+	for _, id := range ids {
+		if id == sgid {
+			return true
+		}
+	}
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,147 @@
+package darfkts3service
+
+import (
+	"testing"
+	"time"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestGroupsCleanup(t *testing.T) {
+	now := time.Now().Unix()
+	store := &fakeStore{
+		groups: []*ts3.Group{
+			{SGID: "10", Name: "with members", EmptySince: now - 100},
+			{SGID: "11", Name: "just emptied"},
+			{SGID: "12", Name: "stale", EmptySince: now - 100},
+			{SGID: "13", Name: "deleted manually"},
+			{SGID: "14", Name: "adopted", EmptySince: now - 100, Adopted: true},
+		},
+	}
+	var deleted []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			sgid := cmd.Params["sgid"][0]
+			switch cmd.Command {
+			case "servergroupclientlist":
+				switch sgid {
+				case "10":
+					return client.ParseResponse("cldbid=1|cldbid=2"), nil
+				case "13":
+					return client.Response{},
+						client.ParseError(`error id=2560 msg=invalid\sgroup\sID`)
+				}
+				return client.Response{},
+					client.ParseError(`error id=1281 msg=database\sempty\sresult\sset`)
+			case "servergroupdel":
+				deleted = append(deleted, sgid)
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(&system.Config{TS3EmptyGroupTTL: 50}, store, e)
+
+	s.groupsCleanup()
+	require.Equal(t, []string{"12"}, deleted)
+	require.Len(t, store.groups, 3)
+	require.Equal(t, int64(0), store.groups[0].EmptySince)
+	require.Equal(t, "11", store.groups[1].SGID)
+	require.NotEqual(t, int64(0), store.groups[1].EmptySince)
+	// Adopted groups are never deleted.
+	require.Equal(t, "14", store.groups[2].SGID)
+}
+
+func TestGroupsCleanupDisabled(t *testing.T) {
+	store := &fakeStore{
+		groups: []*ts3.Group{{SGID: "10", EmptySince: 1}},
+	}
+	e := &fakeExecutor{}
+	s := newTestService(&system.Config{}, store, e)
+
+	s.groupsCleanup()
+	require.Empty(t, e.commands)
+	require.Len(t, store.groups, 1)
+}
+
+func TestAllServerGroupsDelClient(t *testing.T) {
+	config := &system.Config{
+		TS3ProtectedGroupIDs:      []string{"10"},
+		TS3ProtectedGroupPatterns: []string{"^Donor"},
+	}
+	store := &fakeStore{
+		groups: []*ts3.Group{{SGID: "10"}, {SGID: "11"}, {SGID: "12"}},
+	}
+	var removedFrom []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "servergroupsbyclientid":
+				return client.ParseResponse(
+					`name=A sgid=10|name=Donor\sA sgid=11|name=B sgid=12|name=C sgid=13`), nil
+			case "servergroupdelclient":
+				removedFrom = append(removedFrom, cmd.Params["sgid"][0])
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(config, store, e)
+
+	report := s.allServerGroupsDelClient("5")
+	require.Equal(t, []string{"12"}, removedFrom)
+	require.Equal(t, []ts3.GroupRemoval{{SGID: "12", Name: "B"}}, report.Removed)
+	require.Equal(t, []ts3.GroupRemoval{
+		{SGID: "10", Name: "A", Reason: "protected"},
+		{SGID: "11", Name: "Donor A", Reason: "protected"},
+		{SGID: "13", Name: "C", Reason: "not managed"},
+	}, report.Skipped)
+}
+
+func TestAdoptGroups(t *testing.T) {
+	config := &system.Config{TS3ProtectedGroupIDs: []string{"22"}}
+	store := &fakeStore{
+		users: []*ts3.User{{EveCorpID: 100, EveAlliID: 200,
+			EveCorpTicker: "CORP", EveAlliTicker: "ALLI"}},
+		groups: []*ts3.Group{{SGID: "10", Name: "ALLI NEW"}},
+	}
+	var removedFrom []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "servergrouplist":
+				return client.ParseResponse(`sgid=10 name=ALLI\sNEW type=1|` +
+					`sgid=20 name=ALLI\sCORP type=1|sgid=21 name=Members type=1|` +
+					`sgid=22 name=Admins type=1|sgid=23 name=Guest type=1|` +
+					`sgid=24 name=ALLI\sCORP type=0`), nil
+			case "servergroupsbyclientid":
+				return client.ParseResponse(`name=ALLI\sCORP sgid=20|` +
+					`name=Guest sgid=23`), nil
+			case "servergroupdelclient":
+				removedFrom = append(removedFrom, cmd.Params["sgid"][0])
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(config, store, e)
+
+	// A group created before the upgrade and an imported group are adopted.
+	s.adoptGroups([]string{"21", "22"})
+	require.Len(t, store.groups, 3)
+	sgids := []string{store.groups[1].SGID, store.groups[2].SGID}
+	require.ElementsMatch(t, []string{"20", "21"}, sgids)
+	for _, g := range store.groups[1:] {
+		require.True(t, g.Adopted)
+		if g.SGID == "20" {
+			require.Equal(t, int32(100), g.EveCorpID)
+			require.Equal(t, int32(200), g.EveAlliID)
+		}
+	}
+
+	// An invalid user is removed from the adopted group.
+	report := s.allServerGroupsDelClient("5")
+	require.Equal(t, []string{"20"}, removedFrom)
+	require.Len(t, report.Removed, 1)
+}
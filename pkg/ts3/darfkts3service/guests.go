@@ -0,0 +1,241 @@
+package darfkts3service
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	client "github.com/darfk/ts3"
+
+	"github.com/prusya/eve-ts3-service/pkg/notify"
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+const (
+	// guestCommandPrefix starts private text messages with guest commands,
+	// e.g. `!guest approve 12`.
+	guestCommandPrefix = "!guest"
+)
+
+// createGuestRequest stores a pending request of guest u and notifies
+// admins about it.
+func (s *Service) createGuestRequest(u *ts3.User) {
+	r := ts3.GuestRequest{
+		EveCharID:     u.EveCharID,
+		EveCharName:   u.EveCharName,
+		EveCorpTicker: u.EveCorpTicker,
+		EveAlliTicker: u.EveAlliTicker,
+		TS3UID:        u.TS3UID,
+		TS3CLDBID:     u.TS3CLDBID,
+		Status:        ts3.GuestPending,
+		CreatedAt:     time.Now().Unix(),
+	}
+	s.store.CreateGuestRequest(&r)
+
+	fields := userFields(u)
+	fields["request_id"] = strconv.Itoa(r.ID)
+	s.notify(notify.GuestRequested,
+		fmt.Sprintf("%s [%s %s] requests guest access", u.EveCharName,
+			u.EveAlliTicker, u.EveCorpTicker),
+		fields)
+}
+
+// pendingGuestRequest returns a pending guest request with provided id
+// or nil if there is no such request.
+func (s *Service) pendingGuestRequest(id int) *ts3.GuestRequest {
+	for _, r := range s.store.GuestRequests() {
+		if r.ID == id && r.Status == ts3.GuestPending {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// ApproveGuest approves a pending guest request. The guest is granted
+// TS3GuestGroupID for TS3GuestDuration seconds, which config validation
+// requires to be positive once TS3GuestGroupID is set.
+// It returns false if there is no such pending request.
+func (s *Service) ApproveGuest(id int, by string) bool {
+	r := s.decideGuest(id, ts3.GuestApproved, by)
+	if r == nil {
+		return false
+	}
+
+	cfg := s.system.Config()
+	duration := time.Duration(cfg.TS3GuestDuration) * time.Second
+	g := ts3.Grant{
+		SGID:      cfg.TS3GuestGroupID,
+		TS3UID:    r.TS3UID,
+		Reason:    fmt.Sprintf("guest %s approved by %s", r.EveCharName, by),
+		ExpiresAt: time.Now().Add(duration).Unix(),
+	}
+	// Config validation keeps the guest group grantable.
+	if !s.CreateGrant(&g) {
+		log.Printf("%s: guest group sgid=%s can't be granted\n", serviceName,
+			g.SGID)
+		return true
+	}
+
+	r.GrantID = g.ID
+	s.store.UpdateGuestRequest(r)
+
+	return true
+}
+
+// DenyGuest denies a pending guest request and deactivates the guest user.
+// It returns false if there is no such pending request.
+func (s *Service) DenyGuest(id int, by string) bool {
+	r := s.decideGuest(id, ts3.GuestDenied, by)
+	if r == nil {
+		return false
+	}
+
+	s.store.SetUserInactiveByUID(r.TS3UID)
+
+	return true
+}
+
+// decideGuest stores a decision on a pending guest request and returns
+// the request. Only one of concurrent decisions, made on any replica,
+// wins. It returns nil if there is no such pending request.
+func (s *Service) decideGuest(id int, status, by string) *ts3.GuestRequest {
+	r := s.pendingGuestRequest(id)
+	if r == nil {
+		return nil
+	}
+
+	r.Status = status
+	r.DecidedAt = time.Now().Unix()
+	r.DecidedBy = by
+	if !s.store.DecideGuestRequest(r) {
+		return nil
+	}
+	log.Printf("%s: guest request %d of %s %s by %s\n", serviceName, r.ID,
+		r.EveCharName, status, by)
+
+	return r
+}
+
+// guestCommand handles a private text message sent to the service.
+// Members of TS3GuestAdminGroupIDs can list, approve and deny guest
+// requests with `!guest list|approve ID|deny ID` messages.
+func (s *Service) guestCommand(msg map[string]string) {
+	defer recoverPanic()
+
+	args := strings.Fields(msg["msg"])
+	if len(args) == 0 || args[0] != guestCommandPrefix {
+		return
+	}
+	clid := msg["invokerid"]
+	by := msg["invokername"]
+	if !s.isGuestAdmin(msg["invokeruid"]) {
+		s.sendTextMessage(clid, "you are not allowed to manage guests")
+		return
+	}
+
+	usage := "usage: !guest list | !guest approve ID | !guest deny ID"
+	if len(args) < 2 {
+		s.sendTextMessage(clid, usage)
+		return
+	}
+
+	switch args[1] {
+	case "list":
+		var lines []string
+		for _, r := range s.store.GuestRequests() {
+			if r.Status == ts3.GuestPending {
+				lines = append(lines, fmt.Sprintf("%d: %s [%s %s]", r.ID,
+					r.EveCharName, r.EveAlliTicker, r.EveCorpTicker))
+			}
+		}
+		if len(lines) == 0 {
+			lines = []string{"no pending guest requests"}
+		}
+		s.sendTextMessage(clid, strings.Join(lines, "\n"))
+	case "approve", "deny":
+		if len(args) != 3 {
+			s.sendTextMessage(clid, usage)
+			return
+		}
+		id, err := strconv.Atoi(args[2])
+		if err != nil {
+			s.sendTextMessage(clid, usage)
+			return
+		}
+		if args[1] == "approve" && s.system.Config().TS3GuestGroupID == "" {
+			s.sendTextMessage(clid, "guest group is not configured")
+			return
+		}
+
+		ok, status := false, ts3.GuestApproved
+		if args[1] == "approve" {
+			ok = s.ApproveGuest(id, by)
+		} else {
+			ok, status = s.DenyGuest(id, by), ts3.GuestDenied
+		}
+		if !ok {
+			s.sendTextMessage(clid, fmt.Sprintf("no pending guest request %d",
+				id))
+			return
+		}
+		s.sendTextMessage(clid, fmt.Sprintf("guest request %d is %s", id,
+			status))
+	default:
+		s.sendTextMessage(clid, usage)
+	}
+}
+
+// isGuestAdmin checks whether a ts3 client with provided uid is a member
+// of one of TS3GuestAdminGroupIDs.
+func (s *Service) isGuestAdmin(uid string) bool {
+	admins := s.system.Config().TS3GuestAdminGroupIDs
+	if len(admins) == 0 || uid == "" {
+		return false
+	}
+
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "clientgetdbidfromuid",
+		Params: map[string][]string{
+			"cluid": []string{uid},
+		},
+	})
+	system.HandleError(err, serviceName+".isGuestAdmin", "uid="+uid)
+	if len(resp.Params) == 0 {
+		return false
+	}
+
+	resp, err = s.scheduler.Exec(client.Command{
+		Command: "servergroupsbyclientid",
+		Params: map[string][]string{
+			"cldbid": []string{resp.Params[0]["cldbid"]},
+		},
+	})
+	system.HandleError(err, serviceName+".isGuestAdmin", "uid="+uid)
+
+	for _, g := range resp.Params {
+		for _, sgid := range admins {
+			if g["sgid"] == sgid {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// sendTextMessage sends a private text message to a client.
+func (s *Service) sendTextMessage(clid, msg string) {
+	_, err := s.scheduler.Exec(client.Command{
+		Command: "sendtextmessage",
+		Params: map[string][]string{
+			"targetmode": []string{"1"},
+			"target":     []string{clid},
+			"msg":        []string{msg},
+		},
+	})
+	system.HandleError(err, serviceName+".sendTextMessage", "clid="+clid)
+}
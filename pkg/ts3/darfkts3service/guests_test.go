@@ -0,0 +1,133 @@
+package darfkts3service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestGuests(t *testing.T) {
+	store := &fakeStore{}
+	var commands []string
+	var replies []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "clientgetdbidfromuid":
+				return client.ParseResponse(`cluid=x cldbid=` +
+					cmd.Params["cluid"][0]), nil
+			case "servergroupsbyclientid":
+				if cmd.Params["cldbid"][0] == "admin" {
+					return client.ParseResponse(`sgid=6`), nil
+				}
+				return client.ParseResponse(`sgid=8`), nil
+			case "sendtextmessage":
+				replies = append(replies, cmd.Params["msg"][0])
+			default:
+				commands = append(commands, cmd.Command)
+			}
+			return client.Response{}, nil
+		},
+	}
+	config := &system.Config{
+		TS3RegisterTimer:      300,
+		TS3GuestGroupID:       "30",
+		TS3GuestDuration:      3600,
+		TS3GuestAdminGroupIDs: []string{"6"},
+	}
+	s := newTestService(config, store, e)
+
+	// Guests don't get groups on registration.
+	store.CreateRegistration(&ts3.Registration{EveCharID: 1,
+		EveCharName: "guest", Guest: true, CreatedAt: time.Now().Unix()})
+	s.completeRegistration("guest", "", "uid1", "5")
+	require.Empty(t, commands)
+	require.Len(t, store.users, 1)
+	require.True(t, store.users[0].Guest)
+	require.Len(t, store.guests, 1)
+	require.Equal(t, ts3.GuestPending, store.guests[0].Status)
+
+	// Guests are not validated.
+	require.Equal(t, 0, s.ApplyUserStatus(ts3.UserStatus{EveCharID: 1}))
+	require.True(t, store.users[0].Active)
+
+	t.Run("TestGuestCommand", func(t *testing.T) {
+		s.guestCommand(map[string]string{"msg": "!guest list",
+			"invokerid": "2", "invokeruid": "member"})
+		require.Equal(t, []string{"you are not allowed to manage guests"},
+			replies)
+
+		replies = nil
+		s.guestCommand(map[string]string{"msg": "!guest list",
+			"invokerid": "2", "invokeruid": "admin"})
+		require.Equal(t, []string{"1: guest [ ]"}, replies)
+
+		replies = nil
+		s.guestCommand(map[string]string{"msg": "hello",
+			"invokerid": "2", "invokeruid": "admin"})
+		require.Empty(t, replies)
+	})
+
+	t.Run("TestApprove", func(t *testing.T) {
+		require.True(t, s.ApproveGuest(1, "admin"))
+		require.False(t, s.ApproveGuest(1, "admin"))
+		require.Equal(t, ts3.GuestApproved, store.guests[0].Status)
+		require.Len(t, store.grants, 1)
+		require.Equal(t, "30", store.grants[0].SGID)
+		require.Equal(t, "uid1", store.grants[0].TS3UID)
+		require.InDelta(t, time.Now().Unix()+3600, store.grants[0].ExpiresAt, 5)
+		require.Equal(t, store.grants[0].ID, store.guests[0].GrantID)
+	})
+
+	t.Run("TestDeny", func(t *testing.T) {
+		store.guests = append(store.guests, &ts3.GuestRequest{ID: 2,
+			TS3UID: "uid1", Status: ts3.GuestPending})
+		require.True(t, s.DenyGuest(2, "admin"))
+		require.Equal(t, ts3.GuestDenied, store.guests[1].Status)
+		require.False(t, store.users[0].Active)
+	})
+
+	t.Run("TestConcurrentDecisions", func(t *testing.T) {
+		store.guests = append(store.guests, &ts3.GuestRequest{ID: 3,
+			TS3UID: "uid3", Status: ts3.GuestPending})
+		grants := len(store.grants)
+
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		decided := 0
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if s.ApproveGuest(3, "admin") {
+					lock.Lock()
+					decided++
+					lock.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, 1, decided)
+		require.Len(t, store.grants, grants+1)
+		require.False(t, s.DenyGuest(3, "admin"))
+	})
+
+	t.Run("TestMemberAsGuest", func(t *testing.T) {
+		member := &ts3.User{EveCharID: 2, EveCharName: "member",
+			TS3UID: "uid2", Active: true}
+		store.users = append(store.users, member)
+		requests := len(store.guests)
+		store.CreateRegistration(&ts3.Registration{EveCharID: 3,
+			EveCharName: "alt", Guest: true, CreatedAt: time.Now().Unix()})
+		s.completeRegistration("alt", "", "uid2", "6")
+		require.Len(t, store.users, 2)
+		require.False(t, member.Guest)
+		require.Len(t, store.guests, requests)
+	})
+}
@@ -0,0 +1,105 @@
+package darfkts3service
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultKeepAliveInterval        = 30 * time.Second
+	defaultRegisterQCleanupInterval = 40 * time.Second
+	defaultValidateUsersInterval    = 50 * time.Second
+)
+
+// job is a periodic task which never runs concurrently with itself.
+type job struct {
+	run     func()
+	running int32
+}
+
+// newJob creates a new job which calls f when run.
+func newJob(f func()) *job {
+	return &job{run: f}
+}
+
+// tryRun runs the job in the calling goroutine unless it is already running.
+// It reports whether the job was run.
+func (j *job) tryRun() bool {
+	if !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+		return false
+	}
+	defer atomic.StoreInt32(&j.running, 0)
+	j.run()
+
+	return true
+}
+
+// start runs the job in a new goroutine unless it is already running.
+// It reports whether the job was started.
+func (j *job) start() bool {
+	if !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+		return false
+	}
+	go func() {
+		defer atomic.StoreInt32(&j.running, 0)
+		j.run()
+	}()
+
+	return true
+}
+
+// isRunning reports whether the job is running.
+func (j *job) isRunning() bool {
+	return atomic.LoadInt32(&j.running) == 1
+}
+
+// tracked wraps f so that shutdown waits for it to finish.
+// f is only run while the service is the leader and not shutting down.
+func (s *Service) tracked(f func()) func() {
+	return func() {
+		if !s.work.Begin() {
+			return
+		}
+		defer s.work.End()
+		if !s.Leader() {
+			return
+		}
+		f()
+	}
+}
+
+// schedule starts j every interval plus random jitter until term is closed.
+// A tick is skipped if the previous run is still in progress.
+func (s *Service) schedule(j *job, interval, jitter time.Duration,
+	term <-chan struct{}) {
+	for {
+		t := time.NewTimer(withJitter(interval, jitter))
+		select {
+		case <-t.C:
+			j.start()
+		case <-term:
+			t.Stop()
+			return
+		}
+	}
+}
+
+// withJitter adds a random duration in range [0, jitter) to d.
+func withJitter(d, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return d
+	}
+
+	return d + time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// intervalOrDefault converts seconds to time.Duration falling back
+// to def if seconds is not positive.
+func intervalOrDefault(seconds int, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def
+	}
+
+	return time.Duration(seconds) * time.Second
+}
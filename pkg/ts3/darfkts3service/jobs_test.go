@@ -0,0 +1,68 @@
+package darfkts3service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+)
+
+func TestJob(t *testing.T) {
+	release := make(chan struct{})
+	runs := 0
+	j := newJob(func() {
+		runs++
+		<-release
+	})
+
+	require.True(t, j.start())
+	// Wait for the job to enter its func.
+	for !j.isRunning() {
+		time.Sleep(time.Millisecond)
+	}
+	require.False(t, j.start())
+	require.False(t, j.tryRun())
+	close(release)
+	for j.isRunning() {
+		time.Sleep(time.Millisecond)
+	}
+	require.True(t, j.tryRun())
+	require.Equal(t, 2, runs)
+}
+
+func TestWithJitter(t *testing.T) {
+	require.Equal(t, time.Second, withJitter(time.Second, 0))
+	d := withJitter(time.Second, time.Second)
+	require.True(t, d >= time.Second && d < 2*time.Second)
+}
+
+func TestIntervalOrDefault(t *testing.T) {
+	require.Equal(t, time.Minute, intervalOrDefault(0, time.Minute))
+	require.Equal(t, 5*time.Second, intervalOrDefault(5, time.Minute))
+}
+
+func TestShutdownWaitsForJobs(t *testing.T) {
+	s := newTestService(&system.Config{}, &fakeStore{}, &fakeExecutor{})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	j := newJob(s.tracked(func() {
+		close(started)
+		<-release
+	}))
+	require.True(t, j.start())
+	<-started
+
+	// Shutdown gives up once its deadline passes.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.NotNil(t, s.Shutdown(ctx))
+	close(release)
+
+	// No new work is started after shutdown.
+	ran := false
+	s.tracked(func() { ran = true })()
+	require.False(t, ran)
+}
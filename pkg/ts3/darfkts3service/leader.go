@@ -0,0 +1,85 @@
+package darfkts3service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// campaignInterval is how often a replica tries to become the leader.
+	campaignInterval = 10 * time.Second
+	// defaultStepDownTimeout is how long a replica which lost leadership
+	// waits for its running jobs.
+	defaultStepDownTimeout = 30 * time.Second
+)
+
+// campaign tries to become the leader every campaignInterval and leads
+// until leadership is lost or the service is stopped.
+func (s *Service) campaign() {
+	defer close(s.campaignDone)
+
+	for {
+		if s.elector.Acquire() && !s.serveTerm() {
+			return
+		}
+
+		select {
+		case <-time.After(campaignInterval):
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// serveTerm leads until leadership is lost. It returns false if the service
+// was stopped while leading, then Shutdown steps down.
+func (s *Service) serveTerm() bool {
+	log.Printf("%s: elected as the leader\n", serviceName)
+	if !s.tryLead() {
+		log.Printf("%s: failed to start leading, stepping down\n",
+			serviceName)
+		s.stepDown()
+		return true
+	}
+
+	select {
+	case <-s.elector.Lost():
+		log.Printf("%s: lost leadership, stepping down\n", serviceName)
+		s.stepDown()
+		return true
+	case <-s.stopChan:
+		return false
+	}
+}
+
+// tryLead calls lead and reports whether it succeeded.
+func (s *Service) tryLead() (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s: %v\n", serviceName, r)
+			ok = false
+		}
+	}()
+	s.lead()
+
+	return true
+}
+
+// stepDown stops scheduling jobs, waits for running ones, disconnects from
+// ts3 server and gives up leadership so another replica can take over.
+func (s *Service) stepDown() {
+	s.endTerm()
+
+	timeout := intervalOrDefault(s.system.Config().ShutdownTimeout,
+		defaultStepDownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.work.Idle(ctx); err != nil {
+		log.Printf("%s: stepping down with running jobs: %s\n", serviceName,
+			err)
+	}
+
+	s.disconnect()
+	s.elector.Release()
+}
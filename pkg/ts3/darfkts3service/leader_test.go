@@ -0,0 +1,92 @@
+package darfkts3service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+)
+
+// fakeElector never wins an election unless it is told to.
+type fakeElector struct {
+	acquired bool
+	released bool
+	lost     chan struct{}
+}
+
+func (e *fakeElector) Acquire() bool         { return e.acquired }
+func (e *fakeElector) Lost() <-chan struct{} { return e.lost }
+func (e *fakeElector) Release()              { e.released = true }
+
+func TestStepDown(t *testing.T) {
+	s := newTestService(&system.Config{}, &fakeStore{}, &fakeExecutor{})
+	e := &fakeElector{}
+	s.UseElector(e)
+	require.True(t, s.Leader())
+
+	term := s.term
+	s.stepDown()
+	require.False(t, s.Leader())
+	require.True(t, e.released)
+	_, open := <-term
+	require.False(t, open)
+
+	// Jobs don't run on followers.
+	ran := false
+	s.tracked(func() { ran = true })()
+	require.False(t, ran)
+}
+
+func TestCampaign(t *testing.T) {
+	s := newTestService(&system.Config{}, &fakeStore{}, &fakeExecutor{})
+	s.term = nil
+	e := &fakeElector{}
+	s.UseElector(e)
+	s.Start()
+	require.False(t, s.Leader())
+
+	// Shutdown waits for the campaign to end.
+	require.Nil(t, s.Shutdown(context.Background()))
+	<-s.campaignDone
+}
+
+func TestLeadWhileElected(t *testing.T) {
+	addr, _ := fakeQueryServer(t)
+	s := newTestService(&system.Config{TS3Address: addr}, &fakeStore{},
+		&fakeExecutor{})
+	s.term = nil
+	e := &fakeElector{acquired: true, lost: make(chan struct{})}
+	s.UseElector(e)
+
+	// Jobs don't run before the election.
+	ran := false
+	s.tracked(func() { ran = true })()
+	require.False(t, ran)
+
+	s.Start()
+	deadline := time.Now().Add(time.Second)
+	for !s.Leader() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	require.True(t, s.Leader())
+	s.tracked(func() { ran = true })()
+	require.True(t, ran)
+
+	// Losing the election stops jobs and releases leadership.
+	close(e.lost)
+	deadline = time.Now().Add(time.Second)
+	for s.Leader() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	require.False(t, s.Leader())
+	ran = false
+	s.tracked(func() { ran = true })()
+	require.False(t, ran)
+
+	require.Nil(t, s.Shutdown(context.Background()))
+	<-s.campaignDone
+	require.True(t, e.released)
+}
@@ -0,0 +1,148 @@
+package darfkts3service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	client "github.com/darfk/ts3"
+)
+
+var errConnectionClosed = errors.New("ts3 connection closed")
+
+// queryResponse is a response to a ServerQuery command: the last data line
+// and the `error` status line.
+type queryResponse struct {
+	data   string
+	status string
+}
+
+// queryClient is a ServerQuery connection. It speaks the same protocol as
+// client.Client from darfk/ts3 lib and uses the lib's commands and
+// parsers, but its goroutine exits once the connection is closed. The lib
+// never stops its goroutines, so every reconnect would leak them.
+type queryClient struct {
+	conn      net.Conn
+	responses chan queryResponse
+	closed    chan struct{}
+
+	lock          sync.Mutex
+	notifyHandler func(client.Notification)
+}
+
+// dialQuery connects to ServerQuery at address and skips the welcome
+// message. onLost is called once with the client when the connection is
+// closed, either by the server or by Close.
+func dialQuery(address string,
+	onLost func(*queryClient, error)) (*queryClient, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	scan := bufio.NewScanner(conn)
+	scan.Split(scanQueryLines)
+	// The first 2 lines are the welcome message.
+	for i := 0; i < 2; i++ {
+		if !scan.Scan() {
+			conn.Close()
+			if err = scan.Err(); err == nil {
+				err = errConnectionClosed
+			}
+			return nil, err
+		}
+	}
+
+	c := &queryClient{
+		conn:      conn,
+		responses: make(chan queryResponse),
+		closed:    make(chan struct{}),
+	}
+	go c.read(scan, onLost)
+
+	return c, nil
+}
+
+// read dispatches lines received from the server until the connection
+// is closed. Notifications are handled right away, so notify handler
+// must not wait for command responses.
+func (c *queryClient) read(scan *bufio.Scanner, onLost func(*queryClient, error)) {
+	var data string
+	for scan.Scan() {
+		line := scan.Text()
+		switch {
+		case strings.HasPrefix(line, "error"):
+			select {
+			case c.responses <- queryResponse{data: data, status: line}:
+			case <-c.closed:
+			}
+			data = ""
+		case strings.HasPrefix(line, "notify"):
+			c.lock.Lock()
+			h := c.notifyHandler
+			c.lock.Unlock()
+			if h != nil {
+				h(client.ParseNotification(line))
+			}
+		default:
+			data = line
+		}
+	}
+
+	err := scan.Err()
+	if err == nil {
+		err = errors.New("EOF")
+	}
+	close(c.closed)
+	if onLost != nil {
+		onLost(c, err)
+	}
+}
+
+// NotifyHandler sets a handler for server notifications.
+func (c *queryClient) NotifyHandler(h func(client.Notification)) {
+	c.lock.Lock()
+	c.notifyHandler = h
+	c.lock.Unlock()
+}
+
+// Exec sends cmd and waits for its response. It fails with
+// errConnectionClosed if the connection is closed meanwhile.
+func (c *queryClient) Exec(cmd client.Command) (client.Response, error) {
+	_, err := fmt.Fprintf(c.conn, "%s\n\r", cmd)
+	if err != nil {
+		return client.Response{}, err
+	}
+
+	select {
+	case r := <-c.responses:
+		return client.ParseResponse(r.data), client.ParseError(r.status)
+	case <-c.closed:
+		return client.Response{}, errConnectionClosed
+	}
+}
+
+// Close closes the connection, which stops the client's goroutine.
+func (c *queryClient) Close() error {
+	return c.conn.Close()
+}
+
+// scanQueryLines splits ServerQuery output into lines, which end with
+// "\n\r" unlike usual "\r\n".
+func scanQueryLines(data []byte, atEOF bool) (advance int, token []byte,
+	err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.Index(data, []byte("\n\r")); i >= 0 {
+		return i + 2, data[0:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
@@ -0,0 +1,110 @@
+package darfkts3service
+
+import (
+	"bufio"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+)
+
+// fakeQueryServer accepts a single ServerQuery connection, answers every
+// command with `version` data and sends a notification after the first one.
+func fakeQueryServer(t *testing.T) (string, <-chan net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	conns := make(chan net.Conn, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conns <- conn
+		conn.Write([]byte("TS3\n\rWelcome\n\r"))
+		r := bufio.NewReader(conn)
+		for i := 0; ; i++ {
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+			if i == 0 {
+				conn.Write([]byte("notifytextmessage msg=hi\n\r"))
+			}
+			conn.Write([]byte("version=3.0\n\rerror id=0 msg=ok\n\r"))
+		}
+	}()
+
+	return l.Addr().String(), conns
+}
+
+func TestQueryClient(t *testing.T) {
+	addr, conns := fakeQueryServer(t)
+	lost := make(chan error, 2)
+	c, err := dialQuery(addr, func(lc *queryClient, err error) {
+		lost <- err
+	})
+	require.Nil(t, err)
+	conn := <-conns
+	notified := make(chan client.Notification, 1)
+	c.NotifyHandler(func(n client.Notification) {
+		notified <- n
+	})
+
+	resp, err := c.Exec(client.Version())
+	require.Nil(t, err)
+	require.Equal(t, "3.0", resp.Params[0]["version"])
+	n := <-notified
+	require.Equal(t, "notifytextmessage", n.Type)
+	require.Equal(t, "hi", n.Params[0]["msg"])
+
+	// The server going away stops the client.
+	conn.Close()
+	<-lost
+	<-c.closed
+	_, err = c.Exec(client.Version())
+	require.NotNil(t, err)
+	require.Len(t, lost, 0)
+}
+
+func TestQueryClientGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		addr, _ := fakeQueryServer(t)
+		c, err := dialQuery(addr, nil)
+		require.Nil(t, err)
+		_, err = c.Exec(client.Version())
+		require.Nil(t, err)
+		c.Close()
+		<-c.closed
+	}
+
+	// Goroutines of closed clients and fake servers are gone.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, runtime.NumGoroutine() <= before)
+}
+
+func TestConnectionLostReturns(t *testing.T) {
+	s := newTestService(&system.Config{}, &fakeStore{}, &fakeExecutor{})
+	defer s.endTerm()
+	addr, _ := fakeQueryServer(t)
+	returned := make(chan struct{})
+	c, err := dialQuery(addr, func(c *queryClient, err error) {
+		s.connectionLost(c, err)
+		close(returned)
+	})
+	require.Nil(t, err)
+	s.client = c
+
+	// The handler returns, so the client's goroutine exits.
+	c.Close()
+	<-returned
+	require.Nil(t, s.client)
+}
@@ -0,0 +1,341 @@
+package darfkts3service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	client "github.com/darfk/ts3"
+
+	"github.com/prusya/eve-ts3-service/pkg/notify"
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+// registrationStatusTTL is how long a status of an expired registration
+// is kept after its register timer ran out.
+const registrationStatusTTL = 5 * time.Minute
+
+// registrationPollInterval is how often a waiting status request checks
+// the store for a match made by the leader.
+const registrationPollInterval = 500 * time.Millisecond
+
+// registrationTokenBytes is a number of random bytes in a registration
+// token, which is hex encoded.
+const registrationTokenBytes = 4
+
+// newRegistrationToken returns a random token which users may put into
+// their ts3 nickname or description to be matched to a registration.
+func newRegistrationToken() string {
+	b := make([]byte, registrationTokenBytes)
+	_, err := rand.Read(b)
+	system.HandleError(err, serviceName+".newRegistrationToken")
+
+	return hex.EncodeToString(b)
+}
+
+// registrationMatches checks whether a ts3 client with nickname and
+// description belongs to r. The nickname must be equal to r's character
+// name, or the nickname or description must contain r's token.
+func registrationMatches(r *ts3.Registration, nickname,
+	description string) bool {
+	if r.EveCharName == nickname {
+		return true
+	}
+
+	return r.Token != "" && (strings.Contains(nickname, r.Token) ||
+		strings.Contains(description, r.Token))
+}
+
+// registrationStatus returns the current status of r given the register
+// timer in seconds.
+func registrationStatus(r *ts3.Registration, timer int64) string {
+	switch {
+	case r.MatchedAt != 0:
+		return ts3.RegistrationMatched
+	case r.CreatedAt+timer < time.Now().Unix():
+		return ts3.RegistrationExpired
+	}
+
+	return ts3.RegistrationPending
+}
+
+// registrationUser returns a user record for r.
+func registrationUser(r *ts3.Registration) *ts3.User {
+	return &ts3.User{
+		EveCharID:     r.EveCharID,
+		EveCharName:   r.EveCharName,
+		EveCorpID:     r.EveCorpID,
+		EveCorpName:   r.EveCorpName,
+		EveCorpTicker: r.EveCorpTicker,
+		EveAlliID:     r.EveAlliID,
+		EveAlliName:   r.EveAlliName,
+		EveAlliTicker: r.EveAlliTicker,
+		Guest:         r.Guest,
+	}
+}
+
+// registerTimer returns TS3RegisterTimer in seconds.
+func (s *Service) registerTimer() int64 {
+	return int64(s.system.Config().TS3RegisterTimer)
+}
+
+// registrations returns registrations whose status is still reported,
+// newest first.
+func (s *Service) registrations() []*ts3.Registration {
+	since := time.Now().Unix() - s.registerTimer() -
+		int64(registrationStatusTTL/time.Second)
+
+	return s.store.Registrations(since)
+}
+
+// latestRegistration returns the latest registration of an eve character
+// or nil if there is none.
+func (s *Service) latestRegistration(charID int32) *ts3.Registration {
+	for _, r := range s.registrations() {
+		if r.EveCharID == charID {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// RegistrationStatus returns a status of the latest registration of an eve
+// character. If the registration is pending, it waits up to wait for
+// the character's ts3 client to be matched.
+// It returns false if there is no known registration of the character.
+func (s *Service) RegistrationStatus(charID int32,
+	wait time.Duration) (*ts3.RegistrationStatus, bool) {
+	r := s.latestRegistration(charID)
+	if r == nil {
+		return nil, false
+	}
+
+	// Don't wait longer than the registration is valid.
+	expiresAt := time.Unix(r.CreatedAt+s.registerTimer(), 0)
+	if left := time.Until(expiresAt); left < wait {
+		wait = left
+	}
+	// The match may be made by another replica, so the store is polled.
+	deadline := time.Now().Add(wait)
+	for r.MatchedAt == 0 {
+		left := time.Until(deadline)
+		if left <= 0 {
+			break
+		}
+		if left > registrationPollInterval {
+			left = registrationPollInterval
+		}
+		t := time.NewTimer(left)
+		select {
+		case <-t.C:
+		case <-s.stopChan:
+			t.Stop()
+			deadline = time.Now()
+		}
+		if latest := s.latestRegistration(charID); latest != nil {
+			r = latest
+		}
+	}
+
+	st := ts3.RegistrationStatus{
+		EveCharID: charID,
+		Status:    registrationStatus(r, s.registerTimer()),
+		ExpiresAt: r.CreatedAt + s.registerTimer(),
+		Token:     r.Token,
+	}
+	if r.GroupName != "" {
+		st.Groups = []string{r.GroupName}
+	}
+
+	return &st, true
+}
+
+// completeRegistration adds a connected ts3 client to a proper server group
+// and stores the user if there is a pending registration matching
+// the client's nickname or description.
+func (s *Service) completeRegistration(clnickname, cldescription, cluid,
+	cldbid string) {
+	r := s.claimRegistration(clnickname, cldescription)
+	if r == nil {
+		return
+	}
+	defer func() {
+		s.lock.Lock()
+		delete(s.claimed, r.ID)
+		s.lock.Unlock()
+	}()
+
+	user := registrationUser(r)
+	user.TS3UID = cluid
+	user.TS3CLDBID = cldbid
+	user.Active = true
+
+	// Guests get access once an admin approves their request.
+	// Guests are not validated, so members can't become guests.
+	if user.Guest {
+		if s.activeMember(user) {
+			log.Printf("%s: ignoring guest registration of member %s "+
+				"uid=%s\n", serviceName, user.EveCharName, user.TS3UID)
+			return
+		}
+		s.storeUser(user)
+		s.createGuestRequest(user)
+		s.matchRegistration(r, "")
+		return
+	}
+
+	// Add user to the proper group, create it if not found.
+	group := groupName(user)
+	_, sgid := s.userGroup(user, true)
+	s.serverGroupAddClient(sgid, cldbid)
+	s.assignChannelGroups(user)
+
+	// Finally, store user record in the db.
+	s.storeUser(user)
+	s.matchRegistration(r, group)
+
+	s.notify(notify.RegistrationCompleted,
+		fmt.Sprintf("%s registered and was added to %q",
+			user.EveCharName, group),
+		userFields(user))
+}
+
+// activeMember checks whether u's character or ts3 identity belongs to
+// an active user who is not a guest.
+func (s *Service) activeMember(u *ts3.User) bool {
+	for _, m := range s.store.Users() {
+		if m.Active && !m.Guest &&
+			(m.TS3UID == u.TS3UID || m.EveCharID == u.EveCharID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchRegistration marks r as matched, which is seen by status requests
+// on every replica.
+func (s *Service) matchRegistration(r *ts3.Registration, group string) {
+	r.MatchedAt = time.Now().Unix()
+	r.GroupName = group
+	s.store.UpdateRegistration(r)
+}
+
+// storeUser creates a user record or updates the one with the same TS3UID.
+func (s *Service) storeUser(u *ts3.User) {
+	if s.store.TS3UIDExists(u.TS3UID) {
+		s.store.UpdateUserByUID(u)
+	} else {
+		s.store.CreateUser(u)
+	}
+}
+
+// claimRegistration returns the latest pending registration matching
+// clnickname or cldescription and marks it as claimed so it is not matched
+// twice at the same time. It returns nil if there is no such registration.
+func (s *Service) claimRegistration(clnickname,
+	cldescription string) *ts3.Registration {
+	var r *ts3.Registration
+	for _, reg := range s.registrations() {
+		if registrationMatches(reg, clnickname, cldescription) {
+			r = reg
+			break
+		}
+	}
+	if r == nil || registrationStatus(r, s.registerTimer()) !=
+		ts3.RegistrationPending {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.claimed[r.ID] {
+		return nil
+	}
+	s.claimed[r.ID] = true
+
+	return r
+}
+
+// matchOnlineClients completes pending registrations of users who are
+// already connected to ts3 server. clientlist has no descriptions, so
+// they are requested for clients whose nickname matches no registration
+// while there are registrations with tokens.
+func (s *Service) matchOnlineClients() {
+	defer recoverPanic()
+
+	var pending []*ts3.Registration
+	tokens := false
+	for _, r := range s.registrations() {
+		if registrationStatus(r, s.registerTimer()) == ts3.RegistrationPending {
+			pending = append(pending, r)
+			tokens = tokens || r.Token != ""
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "clientlist",
+		Params: map[string][]string{
+			"-uid": []string{},
+		},
+	})
+	system.HandleError(err, serviceName+".matchOnlineClients")
+
+	for _, cl := range resp.Params {
+		// Skip ServerQuery clients.
+		if cl["client_type"] != "0" {
+			continue
+		}
+		nickname := cl["client_nickname"]
+		var description string
+		if !anyRegistrationMatches(pending, nickname, "") {
+			if !tokens {
+				continue
+			}
+			description = s.clientDescription(cl["clid"])
+			if !anyRegistrationMatches(pending, nickname, description) {
+				continue
+			}
+		}
+		s.completeRegistration(nickname, description,
+			cl["client_unique_identifier"], cl["client_database_id"])
+	}
+}
+
+// anyRegistrationMatches checks whether a ts3 client with nickname and
+// description belongs to any of registrations.
+func anyRegistrationMatches(registrations []*ts3.Registration, nickname,
+	description string) bool {
+	for _, r := range registrations {
+		if registrationMatches(r, nickname, description) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientDescription returns a description of an online client or an empty
+// string if the client has left.
+func (s *Service) clientDescription(clid string) string {
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "clientinfo",
+		Params: map[string][]string{
+			"clid": []string{clid},
+		},
+	})
+	if errorID(err) == errInvalidClientID {
+		return ""
+	}
+	system.HandleError(err, serviceName+".clientDescription", "clid="+clid)
+
+	return resp.Params[0]["client_description"]
+}
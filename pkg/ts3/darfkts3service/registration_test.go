@@ -0,0 +1,159 @@
+package darfkts3service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestRegistrationStatus(t *testing.T) {
+	store := &fakeStore{}
+	s := newTestService(&system.Config{TS3RegisterTimer: 300}, store,
+		&fakeExecutor{})
+
+	_, ok := s.RegistrationStatus(1, 0)
+	require.False(t, ok)
+
+	store.CreateRegistration(&ts3.Registration{EveCharID: 1,
+		EveCharName: "char", CreatedAt: time.Now().Unix()})
+	st, ok := s.RegistrationStatus(1, 0)
+	require.True(t, ok)
+	require.Equal(t, ts3.RegistrationPending, st.Status)
+
+	// Waiting request sees the match made by the leader.
+	matched := *store.registrations[0]
+	matched.MatchedAt = time.Now().Unix()
+	matched.GroupName = "ALLI CORP"
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		store.lock.Lock()
+		store.registrations = []*ts3.Registration{&matched}
+		store.lock.Unlock()
+	}()
+	st, ok = s.RegistrationStatus(1, 5*time.Second)
+	require.True(t, ok)
+	require.Equal(t, ts3.RegistrationMatched, st.Status)
+	require.Equal(t, []string{"ALLI CORP"}, st.Groups)
+
+	store.lock.Lock()
+	store.registrations = []*ts3.Registration{
+		{ID: 3, EveCharID: 1, CreatedAt: time.Now().Unix() - 301},
+	}
+	store.lock.Unlock()
+	st, _ = s.RegistrationStatus(1, time.Second)
+	require.Equal(t, ts3.RegistrationExpired, st.Status)
+}
+
+func TestMatchOnlineClients(t *testing.T) {
+	store := &fakeStore{}
+	var added []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "clientlist":
+				return client.ParseResponse(`clid=1 client_database_id=1 ` +
+					`client_nickname=serveradmin client_type=1 ` +
+					`client_unique_identifier=serveradmin|clid=2 ` +
+					`client_database_id=5 client_nickname=char client_type=0 ` +
+					`client_unique_identifier=uid5|clid=3 client_database_id=6 ` +
+					`client_nickname=alt client_type=0 ` +
+					`client_unique_identifier=uid6|clid=4 client_database_id=7 ` +
+					`client_nickname=other client_type=0 ` +
+					`client_unique_identifier=uid7`), nil
+			case "clientinfo":
+				if cmd.Params["clid"][0] == "3" {
+					return client.ParseResponse(`client_description=reg\sab12cd34`), nil
+				}
+				return client.ParseResponse(`client_description`), nil
+			case "servergrouplist":
+				return client.ParseResponse(`sgid=10 name=ALLI\sCORP type=1`), nil
+			case "servergroupaddclient":
+				added = append(added, cmd.Params["sgid"][0]+":"+
+					cmd.Params["cldbid"][0])
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(&system.Config{TS3RegisterTimer: 300}, store, e)
+
+	// Nothing to match, clientlist is not even requested.
+	s.matchOnlineClients()
+	require.Empty(t, e.commands)
+
+	store.CreateRegistration(&ts3.Registration{EveCharID: 1,
+		EveCharName: "char", EveCorpTicker: "CORP", EveAlliTicker: "ALLI",
+		CreatedAt: time.Now().Unix()})
+	s.matchOnlineClients()
+	require.Equal(t, []string{"10:5"}, added)
+	require.Len(t, store.users, 1)
+	require.Equal(t, "uid5", store.users[0].TS3UID)
+
+	st, _ := s.RegistrationStatus(1, 0)
+	require.Equal(t, ts3.RegistrationMatched, st.Status)
+
+	// Matched records are not matched again.
+	s.matchOnlineClients()
+	require.Equal(t, []string{"10:5"}, added)
+
+	// A client is matched by a token in its description.
+	store.CreateRegistration(&ts3.Registration{EveCharID: 2,
+		EveCharName: "main", EveCorpTicker: "CORP", EveAlliTicker: "ALLI",
+		Token: "ab12cd34", CreatedAt: time.Now().Unix()})
+	s.matchOnlineClients()
+	require.Equal(t, []string{"10:5", "10:6"}, added)
+	require.Len(t, store.users, 2)
+	require.Equal(t, "uid6", store.users[1].TS3UID)
+	require.Equal(t, "main", store.users[1].EveCharName)
+}
+
+func TestRegistrationMatches(t *testing.T) {
+	r := &ts3.Registration{EveCharName: "char", Token: "ab12cd34"}
+	require.True(t, registrationMatches(r, "char", ""))
+	require.True(t, registrationMatches(r, "alt ab12cd34", ""))
+	require.True(t, registrationMatches(r, "alt", "my ab12cd34"))
+	require.False(t, registrationMatches(r, "alt", "other"))
+
+	// Registrations without a token match the nickname only.
+	r.Token = ""
+	require.False(t, registrationMatches(r, "alt", ""))
+	require.Len(t, newRegistrationToken(), 2*registrationTokenBytes)
+}
+
+func TestEventHandler(t *testing.T) {
+	store := &fakeStore{}
+	release := make(chan struct{})
+	added := make(chan string, 1)
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "servergrouplist":
+				<-release
+				return client.ParseResponse(`sgid=10 name=ALLI\sCORP type=1`), nil
+			case "servergroupaddclient":
+				added <- cmd.Params["sgid"][0] + ":" + cmd.Params["cldbid"][0]
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(&system.Config{TS3RegisterTimer: 300}, store, e)
+	store.CreateRegistration(&ts3.Registration{EveCharID: 1,
+		EveCharName: "char", EveCorpTicker: "CORP", EveAlliTicker: "ALLI",
+		CreatedAt: time.Now().Unix()})
+
+	// The handler returns while ts3 server is yet to respond, responses
+	// are not read until it does.
+	s.eventHandler(client.ParseNotification(`notifycliententerview ` +
+		`reasonid=0 client_nickname=char client_unique_identifier=uid5 ` +
+		`client_database_id=5`))
+	close(release)
+
+	require.Equal(t, "10:5", <-added)
+	require.Nil(t, s.work.Idle(context.Background()))
+	require.Len(t, store.users, 1)
+}
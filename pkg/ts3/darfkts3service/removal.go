@@ -0,0 +1,139 @@
+package darfkts3service
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	client "github.com/darfk/ts3"
+
+	"github.com/prusya/eve-ts3-service/pkg/notify"
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+const (
+	removeGroups = "groups"
+	removeKick   = "kick"
+	removeMove   = "move"
+	removeBan    = "ban"
+
+	// errInvalidClientID is returned by ts3 server when a client
+	// is not online.
+	errInvalidClientID = 512
+)
+
+// removalRule returns the first removal rule matching user's corp and alli.
+// If there is no such rule, users are only removed from groups.
+func (s *Service) removalRule(u *ts3.User) system.RemovalRule {
+	for _, r := range s.system.Config().TS3RemovalRules {
+		if matchAffiliation(u, r.EveCorpID, r.EveAlliID, r.EveCorpTicker,
+			r.EveAlliTicker) {
+			return r
+		}
+	}
+
+	return system.RemovalRule{Action: removeGroups}
+}
+
+// removeUser removes user from server and channel groups and applies
+// the matching removal rule.
+func (s *Service) removeUser(u *ts3.User) *ts3.RemovalReport {
+	report := s.RevokeUser(u)
+	for _, g := range report.Removed {
+		log.Printf("%s: removed cldbid=%s from group %q sgid=%s\n",
+			serviceName, u.TS3CLDBID, g.Name, g.SGID)
+	}
+	for _, g := range report.Skipped {
+		log.Printf("%s: skipped group %q sgid=%s for cldbid=%s: %s\n",
+			serviceName, g.Name, g.SGID, u.TS3CLDBID, g.Reason)
+	}
+
+	r := s.removalRule(u)
+	switch r.Action {
+	case removeGroups, "":
+	case removeKick:
+		s.KickClient(u.TS3UID, r.Message)
+	case removeMove:
+		s.MoveClient(u.TS3UID, r.ChannelID)
+	case removeBan:
+		s.BanClient(u.TS3UID, r.BanDuration, r.Message)
+	default:
+		log.Printf("%s: unknown removal action %q\n", serviceName, r.Action)
+	}
+
+	fields := userFields(u)
+	fields["action"] = r.Action
+	s.notify(notify.UserRemoved, fmt.Sprintf("%s was removed from comms",
+		u.EveCharName), fields)
+
+	return report
+}
+
+// KickClient kicks all online clients with provided uid from the server.
+func (s *Service) KickClient(uid, reason string) {
+	clids := s.clientIDs(uid)
+	if len(clids) == 0 {
+		return
+	}
+
+	_, err := s.scheduler.Exec(client.Kick(clids, reason))
+	system.HandleError(err, serviceName+".KickClient", "uid="+uid)
+}
+
+// MoveClient moves all online clients with provided uid to a channel.
+func (s *Service) MoveClient(uid, cid string) {
+	clids := s.clientIDs(uid)
+	if len(clids) == 0 {
+		return
+	}
+
+	_, err := s.scheduler.Exec(client.Command{
+		Command: "clientmove",
+		Params: map[string][]string{
+			"clid": clids,
+			"cid":  []string{cid},
+		},
+	})
+	system.HandleError(err, serviceName+".MoveClient", "uid="+uid, "cid="+cid)
+}
+
+// BanClient bans provided uid for duration seconds and kicks its
+// online clients. Zero duration means permanent ban.
+func (s *Service) BanClient(uid string, duration int, reason string) {
+	_, err := s.scheduler.Exec(client.Command{
+		Command: "banadd",
+		Params: map[string][]string{
+			"uid":       []string{uid},
+			"time":      []string{strconv.Itoa(duration)},
+			"banreason": []string{reason},
+		},
+	})
+	system.HandleError(err, serviceName+".BanClient", "uid="+uid)
+
+	s.KickClient(uid, reason)
+}
+
+// clientIDs returns clids of online clients with provided uid.
+func (s *Service) clientIDs(uid string) []string {
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "clientgetids",
+		Params: map[string][]string{
+			"cluid": []string{uid},
+		},
+	})
+	switch errorID(err) {
+	case errEmptyResult, errInvalidClientID:
+		return nil
+	}
+	system.HandleError(err, serviceName+".clientIDs", "uid="+uid)
+
+	var clids []string
+	for _, c := range resp.Params {
+		if clid, ok := c["clid"]; ok {
+			clids = append(clids, clid)
+		}
+	}
+
+	return clids
+}
@@ -0,0 +1,70 @@
+package darfkts3service
+
+import (
+	"testing"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestRemovalRule(t *testing.T) {
+	config := &system.Config{
+		TS3RemovalRules: []system.RemovalRule{
+			{EveCorpID: 100, Action: removeBan},
+			{EveAlliID: 200, Action: removeKick},
+			{EveCorpTicker: "OLD", Action: removeMove},
+		},
+	}
+	s := newTestService(config, &fakeStore{}, &fakeExecutor{})
+
+	// Ids match whatever the current tickers are.
+	r := s.removalRule(&ts3.User{EveCorpID: 100, EveCorpTicker: "NEW",
+		EveAlliID: 200})
+	require.Equal(t, removeBan, r.Action)
+	r = s.removalRule(&ts3.User{EveCorpID: 101, EveAlliID: 200})
+	require.Equal(t, removeKick, r.Action)
+	// Tickers are still matched for rules without ids.
+	r = s.removalRule(&ts3.User{EveCorpID: 102, EveCorpTicker: "OLD"})
+	require.Equal(t, removeMove, r.Action)
+	r = s.removalRule(&ts3.User{EveCorpID: 103, EveCorpTicker: "CORP"})
+	require.Equal(t, removeGroups, r.Action)
+}
+
+func TestRemoveUser(t *testing.T) {
+	config := &system.Config{
+		TS3RemovalRules: []system.RemovalRule{
+			{Action: removeBan, BanDuration: 60, Message: "bye"},
+		},
+	}
+	var removedFrom, kicked []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "servergroupsbyclientid":
+				return client.ParseResponse(
+					"name=Server\\sAdmin sgid=6 cldbid=5|name=ALLI\\sCORP sgid=10 cldbid=5"), nil
+			case "servergroupdelclient":
+				removedFrom = append(removedFrom, cmd.Params["sgid"][0])
+			case "clientgetids":
+				return client.ParseResponse("cluid=uid clid=3 name=user"), nil
+			case "clientkick":
+				kicked = cmd.Params["clid"]
+			}
+			return client.Response{}, nil
+		},
+	}
+	store := &fakeStore{groups: []*ts3.Group{{SGID: "10"}}}
+	s := newTestService(config, store, e)
+
+	report := s.removeUser(&ts3.User{TS3UID: "uid", TS3CLDBID: "5"})
+	require.Equal(t, []string{"10"}, removedFrom)
+	require.Len(t, report.Removed, 1)
+	require.Equal(t, "ALLI CORP", report.Removed[0].Name)
+	require.Len(t, report.Skipped, 1)
+	require.Equal(t, "not managed", report.Skipped[0].Reason)
+	require.Equal(t, []string{"3"}, kicked)
+	require.Contains(t, e.commands, "banadd")
+}
@@ -0,0 +1,195 @@
+package darfkts3service
+
+import (
+	"errors"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	client "github.com/darfk/ts3"
+)
+
+const (
+	// errFlooding is returned by ts3 server when a query client exceeds
+	// the flood limit.
+	errFlooding = 524
+	// errFloodBan is returned by ts3 server when a query client is banned
+	// for flooding.
+	errFloodBan = 3331
+)
+
+var (
+	errorIDRe = regexp.MustCompile(`\((\d+)\)`)
+
+	errNotConnected   = errors.New("not connected to ts3 server")
+	errCommandTimeout = errors.New("ts3 command timed out")
+)
+
+// executor executes ServerQuery commands. It is satisfied by *queryClient.
+type executor interface {
+	Exec(cmd client.Command) (client.Response, error)
+}
+
+// scheduler serializes commands sent to ts3 server and keeps their rate
+// within the server's flood protection limits.
+type scheduler struct {
+	executor executor
+	commands int
+	period   time.Duration
+	retries  int
+	backoff  time.Duration
+	sent     []time.Time
+	lock     sync.Mutex
+
+	// timeout limits how long to wait for a response. onTimeout is called
+	// when a command times out, the connection is unusable after that
+	// since a late response would be read by the next command.
+	timeout   time.Duration
+	onTimeout func()
+	// abandoned counts commands which never got a response.
+	abandoned int
+}
+
+// newScheduler creates a new scheduler which sends at most `commands` commands
+// per `period`. Zero `commands` disables rate limiting, which is the case
+// for whitelisted hosts.
+func newScheduler(e executor, commands int, period time.Duration,
+	retries int) *scheduler {
+	backoff := period
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	return &scheduler{
+		executor: e,
+		commands: commands,
+		period:   period,
+		retries:  retries,
+		backoff:  backoff,
+	}
+}
+
+// setExecutor replaces the executor, e.g. after reconnecting.
+// nil executor makes Exec fail with errNotConnected.
+func (s *scheduler) setExecutor(e executor) {
+	s.lock.Lock()
+	s.executor = e
+	s.sent = nil
+	s.lock.Unlock()
+}
+
+// Exec waits for a free slot in the commands budget and executes cmd.
+// If ts3 server reports flooding, Exec backs off and retries the command.
+// The lock is not held while backing off, so other commands, e.g.
+// keepalive, are not stuck behind a flooded one.
+func (s *scheduler) Exec(cmd client.Command) (client.Response, error) {
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := s.exec(cmd)
+		if !isFloodError(err) || attempt >= s.retries {
+			return resp, err
+		}
+
+		log.Printf("%s: flood protection triggered by %q, retrying in %s\n",
+			serviceName, cmd.Command, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// exec executes cmd once within the commands budget.
+func (s *scheduler) exec(cmd client.Command) (client.Response, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.executor == nil {
+		return client.Response{}, errNotConnected
+	}
+	s.wait()
+
+	return s.execWithTimeout(cmd)
+}
+
+// execWithTimeout executes cmd and gives up waiting for a response after
+// s.timeout. The executor is dropped and closed on timeout, which
+// releases the goroutine waiting for the response.
+// Must be called with s.lock held.
+func (s *scheduler) execWithTimeout(cmd client.Command) (client.Response, error) {
+	if s.timeout <= 0 {
+		return s.executor.Exec(cmd)
+	}
+
+	type result struct {
+		resp client.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	e := s.executor
+	go func() {
+		resp, err := e.Exec(cmd)
+		done <- result{resp, err}
+	}()
+
+	t := time.NewTimer(s.timeout)
+	defer t.Stop()
+	select {
+	case r := <-done:
+		return r.resp, r.err
+	case <-t.C:
+		s.abandoned++
+		log.Printf("%s: %q timed out, %d commands abandoned so far\n",
+			serviceName, cmd.Command, s.abandoned)
+		s.executor = nil
+		if c, ok := e.(io.Closer); ok {
+			c.Close()
+		}
+		if s.onTimeout != nil {
+			go s.onTimeout()
+		}
+		return client.Response{}, errCommandTimeout
+	}
+}
+
+// wait blocks until a command can be sent without exceeding the budget
+// and registers the command as sent.
+// Must be called with s.lock held.
+func (s *scheduler) wait() {
+	if s.commands <= 0 {
+		return
+	}
+
+	now := time.Now()
+	// Forget commands which are out of the current window.
+	for len(s.sent) > 0 && now.Sub(s.sent[0]) >= s.period {
+		s.sent = s.sent[1:]
+	}
+	if len(s.sent) >= s.commands {
+		time.Sleep(s.period - now.Sub(s.sent[0]))
+		s.sent = s.sent[1:]
+	}
+	s.sent = append(s.sent, time.Now())
+}
+
+// errorID extracts ts3 error id from err. It returns 0 if err is nil
+// or is not a ts3 error.
+func errorID(err error) int {
+	if err == nil {
+		return 0
+	}
+	m := errorIDRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	id, _ := strconv.Atoi(m[1])
+
+	return id
+}
+
+// isFloodError checks whether err is caused by ts3 flood protection.
+func isFloodError(err error) bool {
+	id := errorID(err)
+	return id == errFlooding || id == errFloodBan
+}
@@ -0,0 +1,169 @@
+package darfkts3service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExecutor records executed commands and returns queued errors
+// or whatever handler returns.
+type fakeExecutor struct {
+	commands []string
+	errs     []error
+	handler  func(cmd client.Command) (client.Response, error)
+}
+
+func (e *fakeExecutor) Exec(cmd client.Command) (client.Response, error) {
+	e.commands = append(e.commands, cmd.Command)
+	if e.handler != nil {
+		return e.handler(cmd)
+	}
+	var err error
+	if len(e.errs) > 0 {
+		err = e.errs[0]
+		e.errs = e.errs[1:]
+	}
+
+	return client.Response{}, err
+}
+
+func TestErrorID(t *testing.T) {
+	require.Equal(t, 0, errorID(nil))
+	require.Equal(t, 0, errorID(errors.New("an error")))
+	err := client.ParseError(`error id=524 msg=client\sis\sflooding extra_msg=please\swait\s2\sseconds`)
+	require.Equal(t, errFlooding, errorID(err))
+	require.True(t, isFloodError(err))
+	err = client.ParseError(`error id=1281 msg=database\sempty\sresult\sset`)
+	require.False(t, isFloodError(err))
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("TestRetryOnFlood", func(t *testing.T) {
+		e := &fakeExecutor{
+			errs: []error{client.ParseError(`error id=524 msg=client\sis\sflooding`)},
+		}
+		s := newScheduler(e, 0, time.Millisecond, 3)
+		_, err := s.Exec(client.Version())
+		require.Nil(t, err)
+		require.Equal(t, []string{"version", "version"}, e.commands)
+	})
+
+	t.Run("TestRetriesExhausted", func(t *testing.T) {
+		floodErr := client.ParseError(`error id=3331 msg=flood\sban`)
+		e := &fakeExecutor{
+			errs: []error{floodErr, floodErr, floodErr},
+		}
+		s := newScheduler(e, 0, time.Millisecond, 1)
+		_, err := s.Exec(client.Version())
+		require.True(t, isFloodError(err))
+		require.Len(t, e.commands, 2)
+	})
+
+	t.Run("TestNoRetryOnOtherErrors", func(t *testing.T) {
+		e := &fakeExecutor{
+			errs: []error{client.ParseError(`error id=2568 msg=insufficient\sclient\spermissions`)},
+		}
+		s := newScheduler(e, 0, time.Millisecond, 3)
+		_, err := s.Exec(client.Version())
+		require.NotNil(t, err)
+		require.Len(t, e.commands, 1)
+	})
+
+	t.Run("TestBackoffUnlocked", func(t *testing.T) {
+		flooded := make(chan struct{})
+		e := &fakeExecutor{
+			handler: func(cmd client.Command) (client.Response, error) {
+				if cmd.Command == "version" && flooded != nil {
+					close(flooded)
+					flooded = nil
+					return client.Response{},
+						client.ParseError(`error id=524 msg=client\sis\sflooding`)
+				}
+				return client.Response{}, nil
+			},
+		}
+		backoff := time.Second
+		s := newScheduler(e, 0, backoff, 1)
+		done := make(chan struct{})
+		wait := flooded
+		go func() {
+			defer close(done)
+			s.Exec(client.Version())
+		}()
+		<-wait
+
+		// Other commands are sent while the flooded one backs off.
+		start := time.Now()
+		_, err := s.Exec(client.Command{Command: "whoami"})
+		require.Nil(t, err)
+		require.True(t, time.Since(start) < backoff)
+		<-done
+		require.Equal(t, []string{"version", "whoami", "version"}, e.commands)
+	})
+
+	t.Run("TestRateLimit", func(t *testing.T) {
+		e := &fakeExecutor{}
+		period := 50 * time.Millisecond
+		s := newScheduler(e, 2, period, 0)
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			s.Exec(client.Version())
+		}
+		require.True(t, time.Since(start) >= period)
+		require.Len(t, e.commands, 3)
+	})
+}
+
+// blockingExecutor never responds.
+type blockingExecutor struct{}
+
+func (blockingExecutor) Exec(cmd client.Command) (client.Response, error) {
+	select {}
+}
+
+// closingExecutor responds once it is closed.
+type closingExecutor struct {
+	closed chan struct{}
+}
+
+func (e *closingExecutor) Exec(cmd client.Command) (client.Response, error) {
+	<-e.closed
+	return client.Response{}, errors.New("closed")
+}
+
+func (e *closingExecutor) Close() error {
+	close(e.closed)
+	return nil
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	timedOut := make(chan struct{})
+	s := newScheduler(blockingExecutor{}, 0, 0, 0)
+	s.timeout = 10 * time.Millisecond
+	s.onTimeout = func() {
+		close(timedOut)
+	}
+
+	_, err := s.Exec(client.Version())
+	require.Equal(t, errCommandTimeout, err)
+	<-timedOut
+
+	// Connection is dropped after a timeout.
+	_, err = s.Exec(client.Version())
+	require.Equal(t, errNotConnected, err)
+	require.Equal(t, 1, s.abandoned)
+}
+
+func TestSchedulerTimeoutCloses(t *testing.T) {
+	e := &closingExecutor{closed: make(chan struct{})}
+	s := newScheduler(e, 0, 0, 0)
+	s.timeout = 10 * time.Millisecond
+
+	_, err := s.Exec(client.Version())
+	require.Equal(t, errCommandTimeout, err)
+	<-e.closed
+}
@@ -0,0 +1,115 @@
+package darfkts3service
+
+import (
+	client "github.com/darfk/ts3"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+// Connect connects to ts3 server without starting periodic jobs and
+// without subscribing to server notifications, so registrations are left
+// to the running service. It is meant for admin commands which need ts3
+// server for a moment.
+func (s *Service) Connect() {
+	s.connect(false)
+}
+
+// ResyncUser adds u to the server group of its corp and alli and to
+// channel groups, as if the user has just registered.
+func (s *Service) ResyncUser(u *ts3.User) {
+	_, sgid := s.userGroup(u, true)
+	_, err := s.scheduler.Exec(client.Command{
+		Command: "servergroupaddclient",
+		Params: map[string][]string{
+			"sgid":   []string{sgid},
+			"cldbid": []string{u.TS3CLDBID},
+		},
+	})
+	if errorID(err) != errDuplicateEntry {
+		system.HandleError(err, serviceName+".ResyncUser", u)
+	}
+	s.assignChannelGroups(u)
+}
+
+// RevokeUser removes u from channel groups and managed server groups.
+// Unlike validation, removal rules are not applied.
+func (s *Service) RevokeUser(u *ts3.User) *ts3.RemovalReport {
+	s.revokeChannelGroups(u)
+
+	return s.allServerGroupsDelClient(u.TS3CLDBID)
+}
+
+// ImportUsers creates records of existing ts3 members. Users with TS3UID
+// get their cldbid resolved, users without it are matched by character
+// name against nicknames of members of sgids. Unless dryRun, users
+// with the status ImportCreated are stored as active, sgids and groups
+// named after tickers of stored users become managed.
+func (s *Service) ImportUsers(users []*ts3.User, sgids []string,
+	dryRun bool) []ts3.ImportResult {
+	members := make(map[string]map[string]string)
+	for _, sgid := range sgids {
+		list, _ := s.serverGroupClientList(sgid)
+		for _, m := range list {
+			members[m["client_nickname"]] = m
+		}
+	}
+
+	seen := make(map[string]bool)
+	results := make([]ts3.ImportResult, 0, len(users))
+	for _, u := range users {
+		r := ts3.ImportResult{User: u}
+		if u.TS3UID != "" {
+			cldbid, err := s.clientDBID(u.TS3UID)
+			system.HandleError(err, serviceName+".ImportUsers", "uid="+u.TS3UID)
+			u.TS3CLDBID = cldbid
+		} else if m, ok := members[u.EveCharName]; ok {
+			u.TS3UID = m["client_unique_identifier"]
+			u.TS3CLDBID = m["cldbid"]
+		}
+
+		switch {
+		case u.TS3CLDBID == "":
+			r.Status = ts3.ImportNotFound
+		case seen[u.TS3UID]:
+			r.Status = ts3.ImportDuplicate
+		case s.store.TS3UIDExists(u.TS3UID):
+			r.Status = ts3.ImportExists
+		default:
+			r.Status = ts3.ImportCreated
+			u.Active = true
+			if !dryRun {
+				s.store.CreateUser(u)
+			}
+		}
+		if u.TS3UID != "" {
+			seen[u.TS3UID] = true
+		}
+		results = append(results, r)
+	}
+	if !dryRun {
+		s.adoptGroups(sgids)
+	}
+
+	return results
+}
+
+// clientDBID returns cldbid of a client with provided uid. It returns an
+// empty string if ts3 server doesn't know such client.
+func (s *Service) clientDBID(uid string) (string, error) {
+	resp, err := s.scheduler.Exec(client.Command{
+		Command: "clientgetdbidfromuid",
+		Params: map[string][]string{
+			"cluid": []string{uid},
+		},
+	})
+	switch errorID(err) {
+	case errEmptyResult, errInvalidClientID:
+		return "", nil
+	}
+	if err != nil || len(resp.Params) == 0 {
+		return "", err
+	}
+
+	return resp.Params[0]["cldbid"], nil
+}
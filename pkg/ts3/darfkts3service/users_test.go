@@ -0,0 +1,98 @@
+package darfkts3service
+
+import (
+	"errors"
+	"testing"
+
+	client "github.com/darfk/ts3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestResyncUser(t *testing.T) {
+	store := &fakeStore{
+		groups: []*ts3.Group{{SGID: "10", Name: "ALLI CORP", EveCorpID: 100}},
+	}
+	var added []string
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "servergrouplist":
+				return client.ParseResponse(`sgid=10 name=ALLI\sCORP type=1`), nil
+			case "servergroupaddclient":
+				added = append(added, cmd.Params["sgid"][0]+":"+
+					cmd.Params["cldbid"][0])
+				return client.Response{},
+					errors.New("ts3: duplicate entry (2561)")
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(&system.Config{}, store, e)
+
+	// Users who are already in the group are fine.
+	s.ResyncUser(&ts3.User{EveCorpID: 100, EveCorpTicker: "CORP",
+		EveAlliTicker: "ALLI", TS3CLDBID: "5"})
+	require.Equal(t, []string{"10:5"}, added)
+}
+
+func TestImportUsers(t *testing.T) {
+	store := &fakeStore{
+		users: []*ts3.User{{TS3UID: "known", TS3CLDBID: "1", Active: true}},
+	}
+	e := &fakeExecutor{
+		handler: func(cmd client.Command) (client.Response, error) {
+			switch cmd.Command {
+			case "clientgetdbidfromuid":
+				switch cmd.Params["cluid"][0] {
+				case "known":
+					return client.ParseResponse("cluid=known cldbid=1"), nil
+				case "new":
+					return client.ParseResponse("cluid=new cldbid=2"), nil
+				}
+				return client.Response{},
+					errors.New("ts3: database empty result set (1281)")
+			case "servergroupclientlist":
+				return client.ParseResponse("cldbid=3 client_nickname=Pilot " +
+					"client_unique_identifier=member"), nil
+			}
+			return client.Response{}, nil
+		},
+	}
+	s := newTestService(&system.Config{}, store, e)
+
+	users := func() []*ts3.User {
+		return []*ts3.User{
+			{EveCharID: 1, TS3UID: "known"},
+			{EveCharID: 2, TS3UID: "new"},
+			{EveCharID: 3, TS3UID: "missing"},
+			{EveCharID: 4, EveCharName: "Pilot"},
+			{EveCharID: 5, EveCharName: "Nobody"},
+			{EveCharID: 6, TS3UID: "new"},
+		}
+	}
+	statuses := func(results []ts3.ImportResult) []string {
+		var st []string
+		for _, r := range results {
+			st = append(st, r.Status)
+		}
+		return st
+	}
+	expected := []string{ts3.ImportExists, ts3.ImportCreated,
+		ts3.ImportNotFound, ts3.ImportCreated, ts3.ImportNotFound,
+		ts3.ImportDuplicate}
+
+	// Dry run doesn't store anything.
+	results := s.ImportUsers(users(), []string{"10"}, true)
+	require.Equal(t, expected, statuses(results))
+	require.Len(t, store.users, 1)
+
+	results = s.ImportUsers(users(), []string{"10"}, false)
+	require.Equal(t, expected, statuses(results))
+	require.Len(t, store.users, 3)
+	require.Equal(t, "3", results[3].User.TS3CLDBID)
+	require.Equal(t, "member", results[3].User.TS3UID)
+	require.True(t, results[3].User.Active)
+}
@@ -0,0 +1,325 @@
+// Package dump exports records of a ts3.Store into json and csv dumps
+// and restores them into any ts3.Store.
+package dump
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+// Version is a version of dump format written by Export.
+// Version 2 adds groups and guest requests.
+const Version = 2
+
+// Kinds of records. A csv dump holds records of a single kind.
+const (
+	KindUsers  = "users"
+	KindGroups = "groups"
+	KindGrants = "grants"
+	KindGuests = "guests"
+	KindAudit  = "audit"
+)
+
+// Dump holds records of a ts3.Store.
+type Dump struct {
+	Version int
+	// CreatedAt is a unix timestamp.
+	CreatedAt     int64
+	Users         []*ts3.User
+	Groups        []*ts3.Group
+	Grants        []*ts3.Grant
+	GuestRequests []*ts3.GuestRequest
+	AuditEvents   []*ts3.AuditEvent
+}
+
+// Export reads all records of store.
+func Export(store ts3.Store) *Dump {
+	return &Dump{
+		Version:       Version,
+		CreatedAt:     time.Now().Unix(),
+		Users:         store.Users(),
+		Groups:        store.Groups(),
+		Grants:        store.Grants(),
+		GuestRequests: store.GuestRequests(),
+		AuditEvents:   store.AuditEvents(),
+	}
+}
+
+// IsKind checks whether kind is a known kind of records.
+func IsKind(kind string) bool {
+	_, err := (&Dump{}).rows(kind)
+	return err == nil
+}
+
+// WriteJSON writes d as indented json.
+func (d *Dump) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+
+	return e.Encode(d)
+}
+
+// ReadJSON reads a dump written by WriteJSON.
+func ReadJSON(r io.Reader) (*Dump, error) {
+	var d Dump
+	err := json.NewDecoder(r).Decode(&d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// WriteCSV writes records of kind as csv with a header of field names.
+func (d *Dump) WriteCSV(w io.Writer, kind string) error {
+	rows, err := d.rows(kind)
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(rows).Elem()
+	t := v.Type().Elem().Elem()
+
+	cw := csv.NewWriter(w)
+	header := make([]string, t.NumField())
+	for i := range header {
+		header[i] = t.Field(i).Name
+	}
+	cw.Write(header)
+
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i).Elem()
+		record := make([]string, t.NumField())
+		for j := range record {
+			record[j] = fmt.Sprint(row.Field(j).Interface())
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ReadCSV reads records of kind written by WriteCSV. Columns are matched
+// by header, unknown columns are an error.
+func ReadCSV(r io.Reader, kind string) (*Dump, error) {
+	d := &Dump{Version: Version}
+	rows, err := d.rows(kind)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(rows).Elem()
+	t := v.Type().Elem().Elem()
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return d, nil
+	}
+
+	header := records[0]
+	for _, name := range header {
+		if _, ok := t.FieldByName(name); !ok {
+			return nil, fmt.Errorf("unknown %s column %q", kind, name)
+		}
+	}
+	for n, record := range records[1:] {
+		row := reflect.New(t)
+		for i, name := range header {
+			err := setField(row.Elem().FieldByName(name), record[i])
+			if err != nil {
+				return nil, fmt.Errorf("line %d, column %s: %s", n+2, name, err)
+			}
+		}
+		v.Set(reflect.Append(v, row))
+	}
+
+	return d, nil
+}
+
+// rows returns a pointer to d's slice of records of kind.
+func (d *Dump) rows(kind string) (interface{}, error) {
+	switch kind {
+	case KindUsers:
+		return &d.Users, nil
+	case KindGroups:
+		return &d.Groups, nil
+	case KindGrants:
+		return &d.Grants, nil
+	case KindGuests:
+		return &d.GuestRequests, nil
+	case KindAudit:
+		return &d.AuditEvents, nil
+	}
+
+	return nil, fmt.Errorf("unknown kind %q", kind)
+}
+
+// setField parses s into a field of a record.
+func setField(f reflect.Value, s string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(i)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+
+	return nil
+}
+
+// Validate checks that d can be restored.
+func (d *Dump) Validate() error {
+	if d.Version < 1 || d.Version > Version {
+		return fmt.Errorf("unsupported dump version %d", d.Version)
+	}
+
+	uids := make(map[string]bool)
+	cldbids := make(map[string]bool)
+	for _, u := range d.Users {
+		switch {
+		case u.EveCharID == 0:
+			return fmt.Errorf("user %q has no EveCharID", u.TS3UID)
+		case u.TS3UID == "" || u.TS3CLDBID == "":
+			return fmt.Errorf("user of char %d has no TS3UID or TS3CLDBID",
+				u.EveCharID)
+		case uids[u.TS3UID]:
+			return fmt.Errorf("duplicate TS3UID %q", u.TS3UID)
+		case cldbids[u.TS3CLDBID]:
+			return fmt.Errorf("duplicate TS3CLDBID %q", u.TS3CLDBID)
+		}
+		uids[u.TS3UID] = true
+		cldbids[u.TS3CLDBID] = true
+	}
+
+	sgids := make(map[string]bool)
+	for _, g := range d.Groups {
+		switch {
+		case g.SGID == "":
+			return fmt.Errorf("group %q has no SGID", g.Name)
+		case sgids[g.SGID]:
+			return fmt.Errorf("duplicate group SGID %q", g.SGID)
+		}
+		sgids[g.SGID] = true
+	}
+
+	grants := make(map[int]bool)
+	for _, g := range d.Grants {
+		switch {
+		case g.SGID == "":
+			return fmt.Errorf("grant %d has no SGID", g.ID)
+		case (g.TS3UID == "") == (g.EveCharID == 0):
+			return fmt.Errorf("grant %d needs exactly one of TS3UID and "+
+				"EveCharID", g.ID)
+		}
+		grants[g.ID] = true
+	}
+
+	for _, r := range d.GuestRequests {
+		switch {
+		case r.TS3UID == "":
+			return fmt.Errorf("guest request %d has no TS3UID", r.ID)
+		case r.Status != ts3.GuestPending && r.Status != ts3.GuestApproved &&
+			r.Status != ts3.GuestDenied:
+			return fmt.Errorf("guest request %d has unknown status %q", r.ID,
+				r.Status)
+		case r.GrantID != 0 && !grants[r.GrantID]:
+			return fmt.Errorf("guest request %d refers to grant %d which "+
+				"is not in the dump", r.ID, r.GrantID)
+		}
+	}
+
+	for _, e := range d.AuditEvents {
+		if e.Kind == "" {
+			return fmt.Errorf("audit event %d has no Kind", e.ID)
+		}
+	}
+
+	return nil
+}
+
+// Restore validates d and creates its records in store. Records get new
+// IDs, guest requests are updated to refer to new IDs of their grants.
+// Records of a kind are only restored into a store which has none of them,
+// so a dump is never applied twice. Stores which implement Atomic restore
+// all records or none of them.
+func Restore(store ts3.Store, d *Dump) error {
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+
+	if a, ok := store.(atomicStore); ok {
+		return a.Atomic(func(tx ts3.Store) error {
+			return restore(tx, d)
+		})
+	}
+
+	return restore(store, d)
+}
+
+// atomicStore is implemented by stores which can apply changes made by f
+// in a single transaction. Changes are discarded if f fails or panics.
+type atomicStore interface {
+	Atomic(f func(ts3.Store) error) error
+}
+
+// restore creates records of a valid d in store.
+func restore(store ts3.Store, d *Dump) error {
+	switch {
+	case len(d.Users) > 0 && len(store.Users()) > 0:
+		return fmt.Errorf("store already has %s", KindUsers)
+	case len(d.Groups) > 0 && len(store.Groups()) > 0:
+		return fmt.Errorf("store already has %s", KindGroups)
+	case len(d.Grants) > 0 && len(store.Grants()) > 0:
+		return fmt.Errorf("store already has %s", KindGrants)
+	case len(d.GuestRequests) > 0 && len(store.GuestRequests()) > 0:
+		return fmt.Errorf("store already has %s", KindGuests)
+	case len(d.AuditEvents) > 0 && len(store.AuditEvents()) > 0:
+		return fmt.Errorf("store already has %s", KindAudit)
+	}
+
+	for _, u := range d.Users {
+		store.CreateUser(u)
+	}
+	for _, g := range d.Groups {
+		store.CreateGroup(g)
+	}
+	// Grants, guest requests and audit events are exported newest first.
+	grantIDs := make(map[int]int)
+	for i := len(d.Grants) - 1; i >= 0; i-- {
+		g := d.Grants[i]
+		id := g.ID
+		store.CreateGrant(g)
+		grantIDs[id] = g.ID
+	}
+	for i := len(d.GuestRequests) - 1; i >= 0; i-- {
+		r := d.GuestRequests[i]
+		r.GrantID = grantIDs[r.GrantID]
+		store.CreateGuestRequest(r)
+	}
+	for i := len(d.AuditEvents) - 1; i >= 0; i-- {
+		store.CreateAuditEvent(d.AuditEvents[i])
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package dump
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+// memStore keeps records in memory.
+type memStore struct {
+	ts3.Store
+	users  []*ts3.User
+	groups []*ts3.Group
+	grants []*ts3.Grant
+	guests []*ts3.GuestRequest
+	events []*ts3.AuditEvent
+
+	// failAudit makes CreateAuditEvent panic like a failed query.
+	failAudit bool
+}
+
+func (s *memStore) Users() []*ts3.User                 { return s.users }
+func (s *memStore) Groups() []*ts3.Group               { return s.groups }
+func (s *memStore) Grants() []*ts3.Grant               { return s.grants }
+func (s *memStore) GuestRequests() []*ts3.GuestRequest { return s.guests }
+func (s *memStore) AuditEvents() []*ts3.AuditEvent     { return s.events }
+func (s *memStore) CreateUser(u *ts3.User)             { s.users = append(s.users, u) }
+func (s *memStore) CreateGroup(g *ts3.Group)           { s.groups = append(s.groups, g) }
+
+func (s *memStore) CreateGuestRequest(r *ts3.GuestRequest) {
+	r.ID = len(s.guests) + 1
+	s.guests = append([]*ts3.GuestRequest{r}, s.guests...)
+}
+
+func (s *memStore) CreateGrant(g *ts3.Grant) {
+	g.ID = len(s.grants) + 1
+	s.grants = append([]*ts3.Grant{g}, s.grants...)
+}
+
+// atomicMemStore restores records into a copy of its store, which replaces
+// the store once f succeeds.
+type atomicMemStore struct {
+	*memStore
+}
+
+func (s atomicMemStore) Atomic(f func(ts3.Store) error) error {
+	tx := *s.memStore
+	if err := f(&tx); err != nil {
+		return err
+	}
+	*s.memStore = tx
+
+	return nil
+}
+
+func (s *memStore) CreateAuditEvent(e *ts3.AuditEvent) {
+	if s.failAudit {
+		panic("insert failed")
+	}
+	e.ID = len(s.events) + 1
+	s.events = append([]*ts3.AuditEvent{e}, s.events...)
+}
+
+func newTestStore() *memStore {
+	return &memStore{
+		users: []*ts3.User{
+			{ID: 1, EveCharID: 1, EveCharName: "Pilot, Jr", EveCorpTicker: "CORP",
+				TS3UID: "uid1", TS3CLDBID: "1", Active: true},
+			{ID: 2, EveCharID: 2, TS3UID: "uid2", TS3CLDBID: "2", Guest: true},
+		},
+		groups: []*ts3.Group{
+			{SGID: "20", Name: "ALLI CORP", EveCorpID: 100, CreatedAt: 5},
+		},
+		grants: []*ts3.Grant{
+			{ID: 2, SGID: "10", EveCharID: 1, ExpiresAt: 200},
+			{ID: 1, SGID: "10", TS3UID: "uid2", ExpiresAt: 100, Done: true},
+		},
+		guests: []*ts3.GuestRequest{
+			{ID: 1, TS3UID: "uid2", Status: ts3.GuestApproved, GrantID: 1},
+		},
+		events: []*ts3.AuditEvent{
+			{ID: 1, At: 10, Kind: "unregistered_member", Reviewed: true},
+		},
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	src := newTestStore()
+	var buf bytes.Buffer
+	require.Nil(t, Export(src).WriteJSON(&buf))
+
+	d, err := ReadJSON(&buf)
+	require.Nil(t, err)
+	dst := &memStore{}
+	require.Nil(t, Restore(dst, d))
+	require.Equal(t, src.users, dst.users)
+	require.Equal(t, src.groups, dst.groups)
+	require.Equal(t, src.grants, dst.grants)
+	require.Equal(t, src.guests, dst.guests)
+	require.Equal(t, src.events, dst.events)
+
+	// A dump is never restored twice.
+	require.NotNil(t, Restore(dst, d))
+}
+
+func TestRestoreRemapsGrantIDs(t *testing.T) {
+	d := Export(newTestStore())
+	d.Grants[1].ID = 7
+	d.GuestRequests[0].GrantID = 7
+
+	dst := &memStore{}
+	require.Nil(t, Restore(dst, d))
+	require.Equal(t, 1, dst.guests[0].GrantID)
+	require.Equal(t, "uid2", dst.grants[1].TS3UID)
+	require.Equal(t, 1, dst.grants[1].ID)
+}
+
+func TestRestoreAtomic(t *testing.T) {
+	// Audit events are restored last, after other records are created.
+	dst := atomicMemStore{&memStore{failAudit: true}}
+	require.Panics(t, func() { Restore(dst, Export(newTestStore())) })
+	require.Empty(t, dst.users)
+	require.Empty(t, dst.groups)
+	require.Empty(t, dst.grants)
+	require.Empty(t, dst.guests)
+
+	dst.failAudit = false
+	require.Nil(t, Restore(dst, Export(newTestStore())))
+	require.Len(t, dst.users, 2)
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	src := newTestStore()
+	dst := &memStore{}
+	for _, kind := range []string{KindUsers, KindGroups, KindGrants,
+		KindAudit} {
+		var buf bytes.Buffer
+		require.Nil(t, Export(src).WriteCSV(&buf, kind))
+		d, err := ReadCSV(&buf, kind)
+		require.Nil(t, err)
+		require.Nil(t, Restore(dst, d))
+	}
+	require.Equal(t, src.users, dst.users)
+	require.Equal(t, src.groups, dst.groups)
+	require.Equal(t, src.grants, dst.grants)
+	require.Equal(t, src.events, dst.events)
+
+	// Guest requests refer to grants, which get new IDs on restore.
+	// Only requests without grants can be restored from csv.
+	var buf bytes.Buffer
+	require.Nil(t, Export(src).WriteCSV(&buf, KindGuests))
+	d, err := ReadCSV(&buf, KindGuests)
+	require.Nil(t, err)
+	require.NotNil(t, Restore(dst, d))
+	d.GuestRequests[0].GrantID = 0
+	require.Nil(t, Restore(dst, d))
+	require.Len(t, dst.guests, 1)
+
+	_, err = ReadCSV(strings.NewReader("Nope\n1\n"), KindUsers)
+	require.NotNil(t, err)
+	_, err = ReadCSV(strings.NewReader("Active\nmaybe\n"), KindUsers)
+	require.NotNil(t, err)
+	require.NotNil(t, Export(src).WriteCSV(&bytes.Buffer{}, "nope"))
+	require.True(t, IsKind(KindGuests))
+	require.False(t, IsKind("nope"))
+}
+
+func TestValidate(t *testing.T) {
+	for _, d := range []*Dump{
+		{Version: Version + 1},
+		{Version: 1, Users: []*ts3.User{{TS3UID: "uid", TS3CLDBID: "1"}}},
+		{Version: 1, Users: []*ts3.User{{EveCharID: 1, TS3UID: "uid"}}},
+		{Version: 1, Users: []*ts3.User{
+			{EveCharID: 1, TS3UID: "uid", TS3CLDBID: "1"},
+			{EveCharID: 2, TS3UID: "uid", TS3CLDBID: "2"},
+		}},
+		{Version: 1, Grants: []*ts3.Grant{{TS3UID: "uid"}}},
+		{Version: 1, Grants: []*ts3.Grant{{SGID: "10"}}},
+		{Version: 1, AuditEvents: []*ts3.AuditEvent{{}}},
+		{Version: 2, Groups: []*ts3.Group{{Name: "ALLI CORP"}}},
+		{Version: 2, Groups: []*ts3.Group{{SGID: "10"}, {SGID: "10"}}},
+		{Version: 2, GuestRequests: []*ts3.GuestRequest{
+			{Status: ts3.GuestPending}}},
+		{Version: 2, GuestRequests: []*ts3.GuestRequest{
+			{TS3UID: "uid", Status: "maybe"}}},
+		{Version: 2, GuestRequests: []*ts3.GuestRequest{
+			{TS3UID: "uid", Status: ts3.GuestApproved, GrantID: 1}}},
+	} {
+		require.NotNil(t, d.Validate())
+	}
+	require.Nil(t, (&Dump{Version: 1}).Validate())
+}
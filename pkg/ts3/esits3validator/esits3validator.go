@@ -0,0 +1,72 @@
+package esits3validator
+
+import (
+	"github.com/prusya/eve-ts3-service/pkg/esi"
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+	"github.com/prusya/eve-ts3-service/pkg/ts3/allowlistts3validator"
+)
+
+const (
+	validatorName = "esits3validator"
+)
+
+// Validator implements ts3.Validator interface by looking up characters'
+// current affiliation in ESI and checking it against AllowlistFile.
+type Validator struct {
+	system *system.System
+	esi    *esi.Client
+}
+
+// New creates a new Validator.
+func New(system *system.System, esi *esi.Client) *Validator {
+	v := Validator{
+		system: system,
+		esi:    esi,
+	}
+
+	return &v
+}
+
+// Validate returns current corp and alli of users' characters and whether
+// they are allowed.
+func (v *Validator) Validate(users []*ts3.User) []ts3.UserStatus {
+	file := v.system.Config().AllowlistFile
+	a, err := allowlistts3validator.Load(file)
+	system.HandleError(err, validatorName+".Validate",
+		"file="+file)
+
+	ids := make([]int32, 0, len(users))
+	seen := make(map[int32]bool)
+	for _, u := range users {
+		if !seen[u.EveCharID] {
+			seen[u.EveCharID] = true
+			ids = append(ids, u.EveCharID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	affiliations, err := v.esi.Affiliation(ids)
+	system.HandleError(err, validatorName+".Validate", ids)
+
+	statuses := make([]ts3.UserStatus, 0, len(affiliations))
+	for _, af := range affiliations {
+		corp, alli, err := v.esi.Resolve(af)
+		system.HandleError(err, validatorName+".Validate", af)
+
+		statuses = append(statuses, ts3.UserStatus{
+			EveCharID:     af.CharacterID,
+			EveCorpID:     af.CorporationID,
+			EveCorpName:   corp.Name,
+			EveCorpTicker: corp.Ticker,
+			EveAlliID:     af.AllianceID,
+			EveAlliName:   alli.Name,
+			EveAlliTicker: alli.Ticker,
+			Valid:         a.Allows(af.CorporationID, af.AllianceID),
+		})
+	}
+
+	return statuses
+}
@@ -0,0 +1,70 @@
+package esits3validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/esi"
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+// newStubESI creates a server answering like ESI. Character 1 is in an
+// allowed alliance, character 2 is in a corp without alliance.
+func newStubESI() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/characters/affiliation/", func(w http.ResponseWriter,
+		r *http.Request) {
+		fmt.Fprint(w, `[
+			{"character_id": 1, "corporation_id": 100, "alliance_id": 200},
+			{"character_id": 2, "corporation_id": 101}
+		]`)
+	})
+	mux.HandleFunc("/corporations/100/", func(w http.ResponseWriter,
+		r *http.Request) {
+		fmt.Fprint(w, `{"name":"Corp","ticker":"CORP","alliance_id":200}`)
+	})
+	mux.HandleFunc("/corporations/101/", func(w http.ResponseWriter,
+		r *http.Request) {
+		fmt.Fprint(w, `{"name":"Other","ticker":"OTHER"}`)
+	})
+	mux.HandleFunc("/alliances/200/", func(w http.ResponseWriter,
+		r *http.Request) {
+		fmt.Fprint(w, `{"name":"Alliance","ticker":"ALLI"}`)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestValidate(t *testing.T) {
+	server := newStubESI()
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "allowlist")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	json.NewEncoder(f).Encode(map[string][]int32{"AlliIDs": {200}})
+	f.Close()
+
+	sys := system.NewWithConfig(&system.Config{
+		AllowlistFile: f.Name(),
+	})
+	v := New(sys, esi.New(server.URL))
+	statuses := v.Validate([]*ts3.User{{EveCharID: 1}, {EveCharID: 2}})
+	require.Equal(t, []ts3.UserStatus{
+		{EveCharID: 1, EveCorpID: 100, EveCorpName: "Corp",
+			EveCorpTicker: "CORP", EveAlliID: 200, EveAlliName: "Alliance",
+			EveAlliTicker: "ALLI", Valid: true},
+		{EveCharID: 2, EveCorpID: 101, EveCorpName: "Other",
+			EveCorpTicker: "OTHER"},
+	}, statuses)
+
+	require.Nil(t, v.Validate(nil))
+}
@@ -0,0 +1,66 @@
+package httpts3validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+const (
+	validatorName = "httpts3validator"
+)
+
+// Validator implements ts3.Validator interface by asking users validation
+// server configured with UsersValidationEndpoint.
+type Validator struct {
+	system *system.System
+	client *http.Client
+}
+
+// New creates a new Validator.
+func New(system *system.System) *Validator {
+	v := Validator{
+		system: system,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	return &v
+}
+
+// Validate sends users' EveCharIDs to the validation server and returns
+// its response.
+func (v *Validator) Validate(users []*ts3.User) []ts3.UserStatus {
+	ids := make([]int32, 0, len(users))
+	seen := make(map[int32]bool)
+	for _, u := range users {
+		if !seen[u.EveCharID] {
+			seen[u.EveCharID] = true
+			ids = append(ids, u.EveCharID)
+		}
+	}
+
+	// Send ids to the validation server.
+	payload, _ := json.Marshal(ids)
+	resp, err := v.client.Post(v.system.Config().UsersValidationEndpoint,
+		"application/json", bytes.NewBuffer(payload))
+	system.HandleError(err, validatorName+".Validate http.Post", ids)
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		err = errors.New("non 200 response from validation server")
+		system.HandleError(err, validatorName+".Validate", resp.StatusCode)
+	}
+
+	statuses := []ts3.UserStatus{}
+	d := json.NewDecoder(resp.Body)
+	d.UseNumber()
+	err = d.Decode(&statuses)
+	system.HandleError(err, validatorName+".Validate Decode")
+
+	return statuses
+}
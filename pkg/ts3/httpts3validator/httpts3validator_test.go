@@ -0,0 +1,51 @@
+package httpts3validator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/system"
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
+)
+
+func TestValidate(t *testing.T) {
+	var received []int32
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&received)
+			w.Write([]byte(`[{"EveCharID":1,"EveCorpTicker":"CORP","Valid":true}]`))
+		}))
+	defer server.Close()
+
+	sys := system.NewWithConfig(&system.Config{
+		UsersValidationEndpoint: server.URL,
+	})
+	v := New(sys)
+	statuses := v.Validate([]*ts3.User{
+		{EveCharID: 1}, {EveCharID: 1}, {EveCharID: 2},
+	})
+	require.Equal(t, []int32{1, 2}, received)
+	require.Equal(t, []ts3.UserStatus{
+		{EveCharID: 1, EveCorpTicker: "CORP", Valid: true},
+	}, statuses)
+}
+
+func TestValidateNon200(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(500)
+		}))
+	defer server.Close()
+
+	sys := system.NewWithConfig(&system.Config{
+		UsersValidationEndpoint: server.URL,
+	})
+	v := New(sys)
+	require.Panics(t, func() {
+		v.Validate([]*ts3.User{{EveCharID: 1}})
+	})
+}
@@ -1,18 +1,216 @@
 package ts3
 
+import (
+	"time"
+)
+
 // User defines a model for a database and represents a ts3 user.
 type User struct {
 	ID int `storm:"id,unique,increment" db:"id"`
 
 	EveCharID     int32  `db:"eve_char_id"`
 	EveCharName   string `db:"eve_char_name"`
+	EveCorpID     int32  `db:"eve_corp_id"`
+	EveCorpName   string `db:"eve_corp_name"`
 	EveCorpTicker string `db:"eve_corp_ticker"`
+	EveAlliID     int32  `db:"eve_alli_id"`
+	EveAlliName   string `db:"eve_alli_name"`
 	EveAlliTicker string `db:"eve_alli_ticker"`
 
 	TS3UID    string `db:"ts3_uid"`
 	TS3CLDBID string `db:"ts3_cldbid"`
 
 	Active bool `db:"active"`
+	// Guest users are not validated, they get access through
+	// an approved GuestRequest.
+	Guest bool `db:"guest"`
+}
+
+// UserStatus defines a status of an eve character reported by a Validator.
+// Zero corp ID means corp and alli IDs are unknown, empty names
+// mean they are unknown.
+type UserStatus struct {
+	EveCharID     int32
+	EveCorpID     int32
+	EveCorpName   string
+	EveCorpTicker string
+	EveAlliID     int32
+	EveAlliName   string
+	EveAlliTicker string
+	Valid         bool
+}
+
+// Validator defines an interface of how to decide whether users still
+// have access to ts3 service.
+type Validator interface {
+	Validate(users []*User) []UserStatus
+}
+
+// Registration statuses.
+const (
+	RegistrationPending = "pending"
+	RegistrationMatched = "matched"
+	RegistrationExpired = "expired"
+)
+
+// RegistrationStatus represents a state of a registration record.
+type RegistrationStatus struct {
+	EveCharID int32
+	Status    string
+	// ExpiresAt is a unix timestamp when a pending registration expires.
+	ExpiresAt int64
+	// Token matches a ts3 client whose nickname or description contains it.
+	Token string
+	// Groups lists server groups a matched user was added to.
+	Groups []string
+}
+
+// Registration defines a model for a database and represents a registration
+// waiting for an eve character's ts3 client to connect. Registrations are
+// kept in the store so that every replica can accept them.
+type Registration struct {
+	ID int `db:"id"`
+
+	EveCharID     int32  `db:"eve_char_id"`
+	EveCharName   string `db:"eve_char_name"`
+	EveCorpID     int32  `db:"eve_corp_id"`
+	EveCorpName   string `db:"eve_corp_name"`
+	EveCorpTicker string `db:"eve_corp_ticker"`
+	EveAlliID     int32  `db:"eve_alli_id"`
+	EveAlliName   string `db:"eve_alli_name"`
+	EveAlliTicker string `db:"eve_alli_ticker"`
+	Guest         bool   `db:"guest"`
+	// Token is matched to ts3 clients whose nickname or description
+	// contains it, in addition to the nickname equal to EveCharName.
+	Token string `db:"token"`
+
+	// CreatedAt and MatchedAt are unix timestamps.
+	// MatchedAt is 0 while no ts3 client was matched.
+	CreatedAt int64 `db:"created_at"`
+	MatchedAt int64 `db:"matched_at"`
+	// GroupName is a server group the matched user was added to.
+	GroupName string `db:"group_name"`
+}
+
+// Group defines a model for a database and represents a ts3 server group
+// created and managed by the service.
+type Group struct {
+	ID int `db:"id"`
+
+	SGID string `db:"sgid"`
+	Name string `db:"name"`
+
+	// EveCorpID and EveAlliID identify whose members the group is for.
+	// Zero EveCorpID means the group predates ids tracking.
+	EveCorpID int32 `db:"eve_corp_id"`
+	EveAlliID int32 `db:"eve_alli_id"`
+
+	// CreatedAt and EmptySince are unix timestamps.
+	// EmptySince is 0 while the group has members.
+	CreatedAt  int64 `db:"created_at"`
+	EmptySince int64 `db:"empty_since"`
+
+	// Adopted groups were created outside of the service, they are never
+	// deleted by the service.
+	Adopted bool `db:"adopted"`
+}
+
+// AuditEvent defines a model for a database and represents an event
+// which may need admin's review.
+type AuditEvent struct {
+	ID int `db:"id"`
+
+	// At is a unix timestamp.
+	At      int64  `db:"at"`
+	Kind    string `db:"kind"`
+	Details string `db:"details"`
+
+	TS3UID    string `db:"ts3_uid"`
+	TS3CLDBID string `db:"ts3_cldbid"`
+	SGID      string `db:"sgid"`
+
+	Reviewed bool `db:"reviewed"`
+}
+
+// Grant defines a model for a database and represents a time limited
+// membership of a server group. The target is either a ts3 client by TS3UID
+// or all active users of an eve character by EveCharID.
+type Grant struct {
+	ID int `db:"id"`
+
+	SGID      string `db:"sgid"`
+	TS3UID    string `db:"ts3_uid"`
+	EveCharID int32  `db:"eve_char_id"`
+	Reason    string `db:"reason"`
+
+	// CreatedAt, StartsAt and ExpiresAt are unix timestamps.
+	CreatedAt int64 `db:"created_at"`
+	StartsAt  int64 `db:"starts_at"`
+	ExpiresAt int64 `db:"expires_at"`
+
+	// Applied is set while the group is added to the target.
+	// Done is set once the grant expired and the group was removed.
+	Applied bool `db:"applied"`
+	Done    bool `db:"done"`
+}
+
+// Guest request statuses.
+const (
+	GuestPending  = "pending"
+	GuestApproved = "approved"
+	GuestDenied   = "denied"
+)
+
+// GuestRequest defines a model for a database and represents a request
+// of a guest user to get access to ts3 server.
+type GuestRequest struct {
+	ID int `db:"id"`
+
+	EveCharID     int32  `db:"eve_char_id"`
+	EveCharName   string `db:"eve_char_name"`
+	EveCorpTicker string `db:"eve_corp_ticker"`
+	EveAlliTicker string `db:"eve_alli_ticker"`
+
+	TS3UID    string `db:"ts3_uid"`
+	TS3CLDBID string `db:"ts3_cldbid"`
+
+	Status string `db:"status"`
+	// CreatedAt and DecidedAt are unix timestamps.
+	CreatedAt int64  `db:"created_at"`
+	DecidedAt int64  `db:"decided_at"`
+	DecidedBy string `db:"decided_by"`
+	// GrantID is an ID of the Grant giving access to an approved guest.
+	GrantID int `db:"grant_id"`
+}
+
+// GroupRemoval describes a result of removing a user from a server group.
+type GroupRemoval struct {
+	SGID string
+	Name string
+	// Reason is why the group was skipped. Empty for removed groups.
+	Reason string
+}
+
+// RemovalReport lists server groups a user was removed from and groups
+// which were skipped.
+type RemovalReport struct {
+	CLDBID  string
+	Removed []GroupRemoval
+	Skipped []GroupRemoval
+}
+
+// Import statuses.
+const (
+	ImportCreated   = "created"
+	ImportExists    = "exists"
+	ImportNotFound  = "not found"
+	ImportDuplicate = "duplicate"
+)
+
+// ImportResult describes what happened to a user record during import.
+type ImportResult struct {
+	User   *User
+	Status string
 }
 
 // Store defines an interface of how to interact with user model on db level.
@@ -22,10 +220,31 @@ type Store interface {
 	CreateUser(u *User)
 	Users() []*User
 	ActiveUsersCharIDs() []int32
+	UsersByCharID(charID int32) []*User
 	UpdateUser(u *User)
 	UpdateUserByUID(u *User)
 	SetUserInactiveByUID(uid string)
+	DeleteUserByUID(uid string)
 	TS3UIDExists(uid string) bool
+	CreateGroup(g *Group)
+	Groups() []*Group
+	UpdateGroup(g *Group)
+	DeleteGroup(sgid string)
+	CreateAuditEvent(e *AuditEvent)
+	AuditEvents() []*AuditEvent
+	PendingAuditEventExists(kind, cldbid, sgid string) bool
+	SetAuditEventReviewed(id int)
+	CreateGrant(g *Grant)
+	Grants() []*Grant
+	UpdateGrant(g *Grant)
+	CreateGuestRequest(r *GuestRequest)
+	GuestRequests() []*GuestRequest
+	UpdateGuestRequest(r *GuestRequest)
+	DecideGuestRequest(r *GuestRequest) bool
+	CreateRegistration(r *Registration)
+	Registrations(since int64) []*Registration
+	UpdateRegistration(r *Registration)
+	DeleteRegistrationsBefore(at int64)
 }
 
 // Service defines an interface of how to ineract with ts3 service.
@@ -34,5 +253,21 @@ type Service interface {
 	Stop()
 	GetStore() Store
 	ValidateUsers()
+	TriggerValidateUsers() bool
+	ValidateUsersRunning() bool
+	ApplyUserStatus(st UserStatus) int
 	CreateRegisterRecord(u *User)
+	RegistrationStatus(charID int32, wait time.Duration) (*RegistrationStatus, bool)
+	KickClient(uid, reason string)
+	MoveClient(uid, cid string)
+	BanClient(uid string, duration int, reason string)
+	CreateGrant(g *Grant) bool
+	RevokeGrant(id int) bool
+	ApproveGuest(id int, by string) bool
+	DenyGuest(id int, by string) bool
+	Connect()
+	ResyncUser(u *User)
+	RevokeUser(u *User) *RemovalReport
+	ImportUsers(users []*User, sgids []string, dryRun bool) []ImportResult
+	Leader() bool
 }
@@ -1,6 +1,8 @@
 package pgts3store
 
 import (
+	"database/sql"
+
 	"github.com/jmoiron/sqlx"
 
 	"github.com/prusya/eve-ts3-service/pkg/system"
@@ -15,17 +17,114 @@ const (
 		id              SERIAL PRIMARY KEY,
 		eve_char_id     INTEGER NOT NULL,
 		eve_char_name   VARCHAR(50) NOT NULL,
+		eve_corp_id     INTEGER NOT NULL DEFAULT 0,
+		eve_corp_name   VARCHAR(100) NOT NULL DEFAULT '',
 		eve_corp_ticker VARCHAR(50) NOT NULL,
+		eve_alli_id     INTEGER NOT NULL DEFAULT 0,
+		eve_alli_name   VARCHAR(100) NOT NULL DEFAULT '',
 		eve_alli_ticker VARCHAR(50) NOT NULL,
 		ts3_uid         VARCHAR(50) NOT NULL UNIQUE,
 		ts3_cldbid      VARCHAR(50) NOT NULL UNIQUE,
-		active          BOOLEAN
+		active          BOOLEAN,
+		guest           BOOLEAN NOT NULL DEFAULT FALSE
+	)`
+	createGroupTableQuery = `
+	CREATE TABLE IF NOT EXISTS "ts3_group"
+	(
+		id          SERIAL PRIMARY KEY,
+		sgid        VARCHAR(50) NOT NULL UNIQUE,
+		name        VARCHAR(100) NOT NULL,
+		eve_corp_id INTEGER NOT NULL DEFAULT 0,
+		eve_alli_id INTEGER NOT NULL DEFAULT 0,
+		created_at  BIGINT NOT NULL,
+		empty_since BIGINT NOT NULL DEFAULT 0,
+		adopted     BOOLEAN NOT NULL DEFAULT FALSE
+	)`
+	createAuditEventTableQuery = `
+	CREATE TABLE IF NOT EXISTS "ts3_audit_event"
+	(
+		id         SERIAL PRIMARY KEY,
+		at         BIGINT NOT NULL,
+		kind       VARCHAR(50) NOT NULL,
+		details    TEXT NOT NULL,
+		ts3_uid    VARCHAR(50) NOT NULL,
+		ts3_cldbid VARCHAR(50) NOT NULL,
+		sgid       VARCHAR(50) NOT NULL,
+		reviewed   BOOLEAN NOT NULL DEFAULT FALSE
+	)`
+	createGrantTableQuery = `
+	CREATE TABLE IF NOT EXISTS "ts3_grant"
+	(
+		id          SERIAL PRIMARY KEY,
+		sgid        VARCHAR(50) NOT NULL,
+		ts3_uid     VARCHAR(50) NOT NULL DEFAULT '',
+		eve_char_id INTEGER NOT NULL DEFAULT 0,
+		reason      TEXT NOT NULL DEFAULT '',
+		created_at  BIGINT NOT NULL,
+		starts_at   BIGINT NOT NULL,
+		expires_at  BIGINT NOT NULL,
+		applied     BOOLEAN NOT NULL DEFAULT FALSE,
+		done        BOOLEAN NOT NULL DEFAULT FALSE
 	)`
+	addUserAffiliationQuery = `
+	ALTER TABLE "ts3_user"
+	ADD COLUMN IF NOT EXISTS eve_corp_id INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS eve_alli_id INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS eve_corp_name VARCHAR(100) NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS eve_alli_name VARCHAR(100) NOT NULL DEFAULT ''`
+	addUserGuestQuery = `
+	ALTER TABLE "ts3_user"
+	ADD COLUMN IF NOT EXISTS guest BOOLEAN NOT NULL DEFAULT FALSE`
+	createGuestRequestTableQuery = `
+	CREATE TABLE IF NOT EXISTS "ts3_guest_request"
+	(
+		id              SERIAL PRIMARY KEY,
+		eve_char_id     INTEGER NOT NULL,
+		eve_char_name   VARCHAR(50) NOT NULL,
+		eve_corp_ticker VARCHAR(50) NOT NULL,
+		eve_alli_ticker VARCHAR(50) NOT NULL,
+		ts3_uid         VARCHAR(50) NOT NULL,
+		ts3_cldbid      VARCHAR(50) NOT NULL,
+		status          VARCHAR(20) NOT NULL,
+		created_at      BIGINT NOT NULL,
+		decided_at      BIGINT NOT NULL DEFAULT 0,
+		decided_by      VARCHAR(100) NOT NULL DEFAULT '',
+		grant_id        INTEGER NOT NULL DEFAULT 0
+	)`
+	createRegistrationTableQuery = `
+	CREATE TABLE IF NOT EXISTS "ts3_registration"
+	(
+		id              SERIAL PRIMARY KEY,
+		eve_char_id     INTEGER NOT NULL,
+		eve_char_name   VARCHAR(50) NOT NULL,
+		eve_corp_id     INTEGER NOT NULL DEFAULT 0,
+		eve_corp_name   VARCHAR(100) NOT NULL DEFAULT '',
+		eve_corp_ticker VARCHAR(50) NOT NULL,
+		eve_alli_id     INTEGER NOT NULL DEFAULT 0,
+		eve_alli_name   VARCHAR(100) NOT NULL DEFAULT '',
+		eve_alli_ticker VARCHAR(50) NOT NULL,
+		guest           BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at      BIGINT NOT NULL,
+		matched_at      BIGINT NOT NULL DEFAULT 0,
+		group_name      VARCHAR(100) NOT NULL DEFAULT '',
+		token           VARCHAR(50) NOT NULL DEFAULT ''
+	)`
+	addGroupAffiliationQuery = `
+	ALTER TABLE "ts3_group"
+	ADD COLUMN IF NOT EXISTS eve_corp_id INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS eve_alli_id INTEGER NOT NULL DEFAULT 0`
+	addRegistrationTokenQuery = `
+	ALTER TABLE "ts3_registration"
+	ADD COLUMN IF NOT EXISTS token VARCHAR(50) NOT NULL DEFAULT ''`
+	addGroupAdoptedQuery = `
+	ALTER TABLE "ts3_group"
+	ADD COLUMN IF NOT EXISTS adopted BOOLEAN NOT NULL DEFAULT FALSE`
 	createUserQuery = `
 	INSERT INTO "ts3_user"
-	(eve_char_id, eve_char_name, eve_corp_ticker, eve_alli_ticker, 
-		ts3_uid, ts3_cldbid, active)
-	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	(eve_char_id, eve_char_name, eve_corp_id, eve_corp_name, eve_corp_ticker,
+		eve_alli_id, eve_alli_name, eve_alli_ticker, ts3_uid, ts3_cldbid,
+		active, guest)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
 	setUserInactiveByUIDQuery = `
 	UPDATE "ts3_user"
 	SET active = 'f'
@@ -34,41 +133,183 @@ const (
 	UPDATE "ts3_user"
 	SET eve_char_id = $1,
 		eve_char_name = $2,
-		eve_corp_ticker = $3,
-		eve_alli_ticker = $4,
-		ts3_uid = $5,
-		ts3_cldbid = $6,
-		active = $7
-	WHERE id = $8`
+		eve_corp_id = $3,
+		eve_corp_name = $4,
+		eve_corp_ticker = $5,
+		eve_alli_id = $6,
+		eve_alli_name = $7,
+		eve_alli_ticker = $8,
+		ts3_uid = $9,
+		ts3_cldbid = $10,
+		active = $11,
+		guest = $12
+	WHERE id = $13`
 	updateUserByUIDQuery = `
 	UPDATE "ts3_user"
 	SET eve_char_id = $1,
 		eve_char_name = $2,
-		eve_corp_ticker = $3,
-		eve_alli_ticker = $4,
-		ts3_cldbid = $5,
-		active = $6
-	WHERE ts3_uid = $7`
+		eve_corp_id = $3,
+		eve_corp_name = $4,
+		eve_corp_ticker = $5,
+		eve_alli_id = $6,
+		eve_alli_name = $7,
+		eve_alli_ticker = $8,
+		ts3_cldbid = $9,
+		active = $10,
+		guest = $11
+	WHERE ts3_uid = $12`
+	createGroupQuery = `
+	INSERT INTO "ts3_group"
+	(sgid, name, eve_corp_id, eve_alli_id, created_at, empty_since, adopted)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	updateGroupQuery = `
+	UPDATE "ts3_group"
+	SET name = $1,
+		eve_corp_id = $2,
+		eve_alli_id = $3,
+		empty_since = $4
+	WHERE sgid = $5`
+	deleteGroupQuery = `
+	DELETE FROM "ts3_group"
+	WHERE sgid = $1`
+	createAuditEventQuery = `
+	INSERT INTO "ts3_audit_event"
+	(at, kind, details, ts3_uid, ts3_cldbid, sgid, reviewed)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	pendingAuditEventExistsQuery = `
+	SELECT EXISTS(
+		SELECT 1 FROM "ts3_audit_event"
+		WHERE kind = $1 AND ts3_cldbid = $2 AND sgid = $3 AND NOT reviewed
+	)`
+	setAuditEventReviewedQuery = `
+	UPDATE "ts3_audit_event"
+	SET reviewed = 't'
+	WHERE id = $1`
+	createGrantQuery = `
+	INSERT INTO "ts3_grant"
+	(sgid, ts3_uid, eve_char_id, reason, created_at, starts_at, expires_at,
+		applied, done)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id`
+	createGuestRequestQuery = `
+	INSERT INTO "ts3_guest_request"
+	(eve_char_id, eve_char_name, eve_corp_ticker, eve_alli_ticker, ts3_uid,
+		ts3_cldbid, status, created_at, decided_at, decided_by, grant_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	RETURNING id`
+	updateGuestRequestQuery = `
+	UPDATE "ts3_guest_request"
+	SET status = $1,
+		decided_at = $2,
+		decided_by = $3,
+		grant_id = $4
+	WHERE id = $5`
+	decideGuestRequestQuery = `
+	UPDATE "ts3_guest_request"
+	SET status = $1,
+		decided_at = $2,
+		decided_by = $3
+	WHERE id = $4 AND status = $5`
+	createRegistrationQuery = `
+	INSERT INTO "ts3_registration"
+	(eve_char_id, eve_char_name, eve_corp_id, eve_corp_name, eve_corp_ticker,
+		eve_alli_id, eve_alli_name, eve_alli_ticker, guest, created_at,
+		matched_at, group_name, token)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	RETURNING id`
+	registrationsQuery = `
+	SELECT * FROM "ts3_registration"
+	WHERE created_at >= $1
+	ORDER BY created_at DESC, id DESC`
+	updateRegistrationQuery = `
+	UPDATE "ts3_registration"
+	SET matched_at = $1,
+		group_name = $2
+	WHERE id = $3`
+	updateGrantQuery = `
+	UPDATE "ts3_grant"
+	SET expires_at = $1,
+		applied = $2,
+		done = $3
+	WHERE id = $4`
 )
 
 // Store implements ts3.Store interface backed by postgresql and sqlx.
 type Store struct {
-	db *sqlx.DB
+	db queryer
+	// conn is nil for a store running in a transaction.
+	conn *sqlx.DB
+}
+
+// queryer is satisfied by both *sqlx.DB and *sqlx.Tx.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
 }
 
 // New creates a new Store.
 func New(db *sqlx.DB) *Store {
 	s := Store{
-		db: db,
+		db:   db,
+		conn: db,
 	}
 
 	return &s
 }
 
+// Atomic calls f with a store which runs in a transaction. The transaction
+// is committed if f returns nil, otherwise it is rolled back. A panic in f
+// rolls the transaction back and is passed on.
+func (s *Store) Atomic(f func(ts3.Store) error) (err error) {
+	if s.conn == nil {
+		return f(s)
+	}
+
+	tx, err := s.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	err = f(&Store{db: tx})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // Init prepares db for usage.
 func (s *Store) Init() {
 	_, err := s.db.Exec(createUserTableQuery)
 	system.HandleError(err, storeName+".Init")
+	_, err = s.db.Exec(addUserAffiliationQuery)
+	system.HandleError(err, storeName+".Init")
+	_, err = s.db.Exec(createGroupTableQuery)
+	system.HandleError(err, storeName+".Init")
+	_, err = s.db.Exec(addGroupAffiliationQuery)
+	system.HandleError(err, storeName+".Init")
+	_, err = s.db.Exec(addGroupAdoptedQuery)
+	system.HandleError(err, storeName+".Init")
+	_, err = s.db.Exec(createAuditEventTableQuery)
+	system.HandleError(err, storeName+".Init")
+	_, err = s.db.Exec(createGrantTableQuery)
+	system.HandleError(err, storeName+".Init")
+	_, err = s.db.Exec(addUserGuestQuery)
+	system.HandleError(err, storeName+".Init")
+	_, err = s.db.Exec(createGuestRequestTableQuery)
+	system.HandleError(err, storeName+".Init")
+	_, err = s.db.Exec(createRegistrationTableQuery)
+	system.HandleError(err, storeName+".Init")
+	_, err = s.db.Exec(addRegistrationTokenQuery)
+	system.HandleError(err, storeName+".Init")
 }
 
 // Drop placeholder.
@@ -77,7 +318,9 @@ func (s *Store) Drop() {}
 // CreateUser stores a ts3.User record.
 func (s *Store) CreateUser(u *ts3.User) {
 	_, err := s.db.Exec(createUserQuery, u.EveCharID, u.EveCharName,
-		u.EveCorpTicker, u.EveAlliTicker, u.TS3UID, u.TS3CLDBID, u.Active)
+		u.EveCorpID, u.EveCorpName, u.EveCorpTicker, u.EveAlliID,
+		u.EveAlliName, u.EveAlliTicker, u.TS3UID, u.TS3CLDBID, u.Active,
+		u.Guest)
 	system.HandleError(err, storeName+".CreateUser", u)
 }
 
@@ -90,6 +333,16 @@ func (s *Store) Users() []*ts3.User {
 	return users
 }
 
+// UsersByCharID returns ts3.User records with provided EveCharID.
+func (s *Store) UsersByCharID(charID int32) []*ts3.User {
+	var users []*ts3.User
+	err := s.db.Select(&users,
+		`SELECT * FROM "ts3_user" WHERE eve_char_id=$1`, charID)
+	system.HandleError(err, storeName+".UsersByCharID", charID)
+
+	return users
+}
+
 // ActiveUsersCharIDs returns EveCharIDs of users with `Active` set to true.
 func (s *Store) ActiveUsersCharIDs() []int32 {
 	var ids []int32
@@ -112,14 +365,18 @@ func (s *Store) TS3UIDExists(uid string) bool {
 // UpdateUser updates a ts3.User record.
 func (s *Store) UpdateUser(u *ts3.User) {
 	_, err := s.db.Exec(updateUserQuery, u.EveCharID, u.EveCharName,
-		u.EveCorpTicker, u.EveAlliTicker, u.TS3UID, u.TS3CLDBID, u.Active, u.ID)
+		u.EveCorpID, u.EveCorpName, u.EveCorpTicker, u.EveAlliID,
+		u.EveAlliName, u.EveAlliTicker, u.TS3UID, u.TS3CLDBID, u.Active,
+		u.Guest, u.ID)
 	system.HandleError(err, storeName+".UpdateUser", u)
 }
 
 // UpdateUserByUID updates a ts3.User record.
 func (s *Store) UpdateUserByUID(u *ts3.User) {
 	_, err := s.db.Exec(updateUserByUIDQuery, u.EveCharID, u.EveCharName,
-		u.EveCorpTicker, u.EveAlliTicker, u.TS3CLDBID, u.Active, u.TS3UID)
+		u.EveCorpID, u.EveCorpName, u.EveCorpTicker, u.EveAlliID,
+		u.EveAlliName, u.EveAlliTicker, u.TS3CLDBID, u.Active, u.Guest,
+		u.TS3UID)
 	system.HandleError(err, storeName+".UpdateUserByUID", u)
 }
 
@@ -128,3 +385,166 @@ func (s *Store) SetUserInactiveByUID(uid string) {
 	_, err := s.db.Exec(setUserInactiveByUIDQuery, uid)
 	system.HandleError(err, storeName+".SetUserInactiveByUID", "uid="+uid)
 }
+
+// DeleteUserByUID deletes a ts3.User record with provided uid.
+func (s *Store) DeleteUserByUID(uid string) {
+	_, err := s.db.Exec(`DELETE FROM "ts3_user" WHERE ts3_uid=$1`, uid)
+	system.HandleError(err, storeName+".DeleteUserByUID", "uid="+uid)
+}
+
+// CreateGroup stores a ts3.Group record.
+func (s *Store) CreateGroup(g *ts3.Group) {
+	_, err := s.db.Exec(createGroupQuery, g.SGID, g.Name, g.EveCorpID,
+		g.EveAlliID, g.CreatedAt, g.EmptySince, g.Adopted)
+	system.HandleError(err, storeName+".CreateGroup", g)
+}
+
+// Groups returns all ts3.Group records.
+func (s *Store) Groups() []*ts3.Group {
+	var groups []*ts3.Group
+	err := s.db.Select(&groups, `SELECT * FROM "ts3_group"`)
+	system.HandleError(err, storeName+".Groups")
+
+	return groups
+}
+
+// UpdateGroup updates a ts3.Group record.
+func (s *Store) UpdateGroup(g *ts3.Group) {
+	_, err := s.db.Exec(updateGroupQuery, g.Name, g.EveCorpID, g.EveAlliID,
+		g.EmptySince, g.SGID)
+	system.HandleError(err, storeName+".UpdateGroup", g)
+}
+
+// DeleteGroup deletes a ts3.Group record with provided sgid.
+func (s *Store) DeleteGroup(sgid string) {
+	_, err := s.db.Exec(deleteGroupQuery, sgid)
+	system.HandleError(err, storeName+".DeleteGroup", "sgid="+sgid)
+}
+
+// CreateAuditEvent stores a ts3.AuditEvent record.
+func (s *Store) CreateAuditEvent(e *ts3.AuditEvent) {
+	_, err := s.db.Exec(createAuditEventQuery, e.At, e.Kind, e.Details,
+		e.TS3UID, e.TS3CLDBID, e.SGID, e.Reviewed)
+	system.HandleError(err, storeName+".CreateAuditEvent", e)
+}
+
+// AuditEvents returns all ts3.AuditEvent records, newest first.
+func (s *Store) AuditEvents() []*ts3.AuditEvent {
+	var events []*ts3.AuditEvent
+	err := s.db.Select(&events,
+		`SELECT * FROM "ts3_audit_event" ORDER BY at DESC, id DESC`)
+	system.HandleError(err, storeName+".AuditEvents")
+
+	return events
+}
+
+// PendingAuditEventExists checks if a not reviewed record of kind exists
+// for provided cldbid and sgid.
+func (s *Store) PendingAuditEventExists(kind, cldbid, sgid string) bool {
+	var exists bool
+	err := s.db.Get(&exists, pendingAuditEventExistsQuery, kind, cldbid, sgid)
+	system.HandleError(err, storeName+".PendingAuditEventExists",
+		"kind="+kind, "cldbid="+cldbid, "sgid="+sgid)
+
+	return exists
+}
+
+// SetAuditEventReviewed sets `reviewed` to true for provided id.
+func (s *Store) SetAuditEventReviewed(id int) {
+	_, err := s.db.Exec(setAuditEventReviewedQuery, id)
+	system.HandleError(err, storeName+".SetAuditEventReviewed", id)
+}
+
+// CreateGrant stores a ts3.Grant record and sets its ID.
+func (s *Store) CreateGrant(g *ts3.Grant) {
+	err := s.db.Get(&g.ID, createGrantQuery, g.SGID, g.TS3UID, g.EveCharID,
+		g.Reason, g.CreatedAt, g.StartsAt, g.ExpiresAt, g.Applied, g.Done)
+	system.HandleError(err, storeName+".CreateGrant", g)
+}
+
+// Grants returns all ts3.Grant records, newest first.
+func (s *Store) Grants() []*ts3.Grant {
+	var grants []*ts3.Grant
+	err := s.db.Select(&grants, `SELECT * FROM "ts3_grant" ORDER BY id DESC`)
+	system.HandleError(err, storeName+".Grants")
+
+	return grants
+}
+
+// UpdateGrant updates expiration and state of a ts3.Grant record.
+func (s *Store) UpdateGrant(g *ts3.Grant) {
+	_, err := s.db.Exec(updateGrantQuery, g.ExpiresAt, g.Applied, g.Done,
+		g.ID)
+	system.HandleError(err, storeName+".UpdateGrant", g)
+}
+
+// CreateGuestRequest stores a ts3.GuestRequest record and sets its ID.
+func (s *Store) CreateGuestRequest(r *ts3.GuestRequest) {
+	err := s.db.Get(&r.ID, createGuestRequestQuery, r.EveCharID,
+		r.EveCharName, r.EveCorpTicker, r.EveAlliTicker, r.TS3UID, r.TS3CLDBID,
+		r.Status, r.CreatedAt, r.DecidedAt, r.DecidedBy, r.GrantID)
+	system.HandleError(err, storeName+".CreateGuestRequest", r)
+}
+
+// GuestRequests returns all ts3.GuestRequest records, newest first.
+func (s *Store) GuestRequests() []*ts3.GuestRequest {
+	var requests []*ts3.GuestRequest
+	err := s.db.Select(&requests,
+		`SELECT * FROM "ts3_guest_request" ORDER BY id DESC`)
+	system.HandleError(err, storeName+".GuestRequests")
+
+	return requests
+}
+
+// UpdateGuestRequest updates a decision on a ts3.GuestRequest record.
+func (s *Store) UpdateGuestRequest(r *ts3.GuestRequest) {
+	_, err := s.db.Exec(updateGuestRequestQuery, r.Status, r.DecidedAt,
+		r.DecidedBy, r.GrantID, r.ID)
+	system.HandleError(err, storeName+".UpdateGuestRequest", r)
+}
+
+// DecideGuestRequest stores a decision on a pending ts3.GuestRequest record.
+// It reports false if the request was already decided.
+func (s *Store) DecideGuestRequest(r *ts3.GuestRequest) bool {
+	res, err := s.db.Exec(decideGuestRequestQuery, r.Status, r.DecidedAt,
+		r.DecidedBy, r.ID, ts3.GuestPending)
+	system.HandleError(err, storeName+".DecideGuestRequest", r)
+	n, err := res.RowsAffected()
+	system.HandleError(err, storeName+".DecideGuestRequest", r)
+
+	return n == 1
+}
+
+// CreateRegistration stores a ts3.Registration record and sets its ID.
+func (s *Store) CreateRegistration(r *ts3.Registration) {
+	err := s.db.Get(&r.ID, createRegistrationQuery, r.EveCharID,
+		r.EveCharName, r.EveCorpID, r.EveCorpName, r.EveCorpTicker, r.EveAlliID,
+		r.EveAlliName, r.EveAlliTicker, r.Guest, r.CreatedAt, r.MatchedAt,
+		r.GroupName, r.Token)
+	system.HandleError(err, storeName+".CreateRegistration", r)
+}
+
+// Registrations returns ts3.Registration records created at or after since,
+// newest first.
+func (s *Store) Registrations(since int64) []*ts3.Registration {
+	var registrations []*ts3.Registration
+	err := s.db.Select(&registrations, registrationsQuery, since)
+	system.HandleError(err, storeName+".Registrations", since)
+
+	return registrations
+}
+
+// UpdateRegistration updates a match of a ts3.Registration record.
+func (s *Store) UpdateRegistration(r *ts3.Registration) {
+	_, err := s.db.Exec(updateRegistrationQuery, r.MatchedAt, r.GroupName,
+		r.ID)
+	system.HandleError(err, storeName+".UpdateRegistration", r)
+}
+
+// DeleteRegistrationsBefore deletes ts3.Registration records created
+// before at.
+func (s *Store) DeleteRegistrationsBefore(at int64) {
+	_, err := s.db.Exec(`DELETE FROM "ts3_registration" WHERE created_at < $1`,
+		at)
+	system.HandleError(err, storeName+".DeleteRegistrationsBefore", at)
+}
@@ -5,10 +5,22 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/require"
+
+	"github.com/prusya/eve-ts3-service/pkg/ts3"
 )
 
 func TestNew(t *testing.T) {
 	db := &sqlx.DB{}
 	store := New(db)
 	require.Equal(t, db, store.db)
+	require.Equal(t, db, store.conn)
+
+	// A store in a transaction runs nested calls in it.
+	tx := &Store{db: &sqlx.Tx{}}
+	var inner interface{}
+	require.Nil(t, tx.Atomic(func(s ts3.Store) error {
+		inner = s
+		return nil
+	}))
+	require.Equal(t, tx, inner)
 }